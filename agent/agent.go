@@ -4,28 +4,86 @@ import (
 	"bytes"
 	"distributed_calculator/tasks"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/big"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
-func Worker() {
+// Worker выполняет задачи оркестратора; id отличает агентов друг от друга в плане выражения
+func Worker(id int) {
+	name := fmt.Sprintf("agent-%d", id)
 	for {
-		task, err := getTask()
+		task, err := getTask(name)
 		if err != nil {
 			time.Sleep(10 * time.Millisecond)
 			continue
 		}
 
-		result, e := performTask(task)
-		postTaskResult(task.ID, result, e)
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			keepLease(task, name, stop)
+			close(stopped)
+		}()
+		result, e := runTask(task)
+		close(stop)
+		<-stopped // продление, отправленное после результата, не найдет задачу
+		postTaskResult(task.ID, name, result, e)
 	}
 }
 
-func getTask() (*tasks.Task, error) {
-	resp, err := http.Get("http://localhost:8080/internal/task")
+var errLeaseLost = errors.New("lease lost")
+
+// keepLease продлевает аренду задачи, пока агент ее выполняет. Аренда продлевается трижды
+// за свой срок, чтобы одно неудачное продление не отняло задачу у агента
+func keepLease(task *tasks.Task, name string, stop <-chan struct{}) {
+	if task.LeaseMs <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(task.LeaseMs) * time.Millisecond / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := heartbeat(task.ID, name)
+			if errors.Is(err, errLeaseLost) {
+				log.Printf("Task #%d: %v", task.ID, err)
+				return
+			}
+			if err != nil {
+				log.Println("Failed to extend task lease:", err)
+			}
+		}
+	}
+}
+
+func heartbeat(id int, name string) error {
+	resp, err := http.Post(fmt.Sprintf("http://localhost:8080/internal/task/%d/heartbeat?agent=%s", id, url.QueryEscape(name)),
+		"application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound, http.StatusConflict: // аренда истекла или задача у другого агента
+		return errLeaseLost
+	}
+	return fmt.Errorf("unexpected status: %v", resp.Status)
+}
+
+func getTask(name string) (*tasks.Task, error) {
+	resp, err := http.Get("http://localhost:8080/internal/task?agent=" + url.QueryEscape(name))
 	if err != nil {
 		return nil, err
 	}
@@ -51,30 +109,206 @@ func getTask() (*tasks.Task, error) {
 	return &taskResponse.Task, nil
 }
 
-func performTask(task *tasks.Task) (int, error) {
+const maxBigIntBits = 1 << 20 // ограничение размера результата возведения в степень
+
+// runTask выполняет задачу и превращает панику в ошибку задачи: агенты работают
+// внутри оркестратора, и одна некорректная задача не должна останавливать сервер
+func runTask(task *tasks.Task) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Task #%d: panic: %v", task.ID, r)
+			result, err = "", fmt.Errorf("internal error")
+		}
+	}()
+	return performTask(task)
+}
+
+func performTask(task *tasks.Task) (string, error) {
 	time.Sleep(time.Duration(task.OperationTime) * time.Millisecond)
 
-	arg1 := task.Arg1
-	arg2 := task.Arg2
+	if task.Args != nil {
+		return performFunctionTask(task)
+	}
+	if logicalOperators[task.Operator] {
+		return performLogicalTask(task)
+	}
+	if bitwiseOperators[task.Operator] {
+		return performBitwiseTask(task)
+	}
+
+	switch task.Mode {
+	case tasks.BigIntMode:
+		return performBigIntTask(task)
+	case tasks.RationalMode:
+		return performRationalTask(task)
+	}
+	return performFloatTask(task)
+}
+
+func performFloatTask(task *tasks.Task) (string, error) {
+	arg1, err1 := strconv.ParseFloat(task.Arg1, 64)
+	arg2, err2 := strconv.ParseFloat(task.Arg2, 64)
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("invalid arguments")
+	}
+
+	var result float64
+	switch task.Operator {
+	case "+":
+		result = arg1 + arg2
+	case "-":
+		result = arg1 - arg2
+	case "*":
+		result = arg1 * arg2
+	case "/":
+		if arg2 == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		result = arg1 / arg2
+	case "^":
+		result = math.Pow(arg1, arg2)
+	case "%":
+		if arg2 == 0 {
+			return "", fmt.Errorf("modulo by zero")
+		}
+		result = math.Mod(arg1, arg2)
+		if result != 0 && (result < 0) != (arg2 < 0) { // знак остатка совпадает со знаком делителя
+			result += arg2
+		}
+	case "//":
+		if arg2 == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		result = math.Floor(arg1 / arg2)
+	default:
+		return "", fmt.Errorf("unknown operator")
+	}
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return "", fmt.Errorf("result out of range")
+	}
+	return formatFloat(result), nil
+}
+
+// formatFloat записывает результат задачи в режиме float. У нуля нет знака:
+// -0 давал бы другой ключ кэша результатов, чем 0
+func formatFloat(value float64) string {
+	if value == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
 
+func performBigIntTask(task *tasks.Task) (string, error) {
+	arg1, ok1 := new(big.Int).SetString(task.Arg1, 10)
+	arg2, ok2 := new(big.Int).SetString(task.Arg2, 10)
+	if !ok1 || !ok2 {
+		return "", fmt.Errorf("invalid arguments")
+	}
+
+	result := new(big.Int)
 	switch task.Operator {
 	case "+":
-		return arg1 + arg2, nil
+		result.Add(arg1, arg2)
 	case "-":
-		return arg1 - arg2, nil
+		result.Sub(arg1, arg2)
 	case "*":
-		return arg1 * arg2, nil
+		result.Mul(arg1, arg2)
 	case "/":
-		if arg2 != 0 {
-			return arg1 / arg2, nil
+		if arg2.Sign() == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		result.Quo(arg1, arg2) // как и для int, остаток отбрасывается
+	case "^":
+		if arg2.Sign() < 0 {
+			return "", fmt.Errorf("negative exponent in bigint mode")
+		}
+		// размер результата сравнивается делением, чтобы произведение не переполнило int64
+		if arg1.BitLen() > 1 && (!arg2.IsInt64() || arg2.Int64() > maxBigIntBits/int64(arg1.BitLen())) {
+			return "", fmt.Errorf("result out of range")
+		}
+		result.Exp(arg1, arg2, nil)
+	case "%", "//":
+		if arg2.Sign() == 0 {
+			if task.Operator == "%" {
+				return "", fmt.Errorf("modulo by zero")
+			}
+			return "", fmt.Errorf("division by zero")
+		}
+		quotient, remainder := new(big.Int).QuoRem(arg1, arg2, new(big.Int))
+		if remainder.Sign() != 0 && remainder.Sign() != arg2.Sign() { // округление частного вниз
+			quotient.Sub(quotient, big.NewInt(1))
+			remainder.Add(remainder, arg2)
+		}
+		if task.Operator == "%" {
+			result = remainder
+		} else {
+			result = quotient
+		}
+	default:
+		return "", fmt.Errorf("unknown operator")
+	}
+	return result.String(), nil
+}
+
+func performRationalTask(task *tasks.Task) (string, error) {
+	arg1, ok1 := new(big.Rat).SetString(task.Arg1)
+	arg2, ok2 := new(big.Rat).SetString(task.Arg2)
+	if !ok1 || !ok2 {
+		return "", fmt.Errorf("invalid arguments")
+	}
+
+	result := new(big.Rat)
+	switch task.Operator {
+	case "+":
+		result.Add(arg1, arg2)
+	case "-":
+		result.Sub(arg1, arg2)
+	case "*":
+		result.Mul(arg1, arg2)
+	case "/":
+		if arg2.Sign() == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		result.Quo(arg1, arg2)
+	case "^":
+		if !arg2.IsInt() || !arg2.Num().IsInt64() {
+			return "", fmt.Errorf("exponent must be an integer in rational mode")
+		}
+		exponent := arg2.Num().Int64()
+		if exponent < 0 && arg1.Sign() == 0 {
+			return "", fmt.Errorf("division by zero")
+		}
+		limit := maxBigIntBits / int64(arg1.Num().BitLen()+arg1.Denom().BitLen())
+		if exponent > limit || exponent < -limit {
+			return "", fmt.Errorf("result out of range")
+		}
+		power := big.NewInt(exponent)
+		power.Abs(power)
+		result.SetFrac(new(big.Int).Exp(arg1.Num(), power, nil), new(big.Int).Exp(arg1.Denom(), power, nil))
+		if exponent < 0 {
+			result.Inv(result)
+		}
+	case "%", "//":
+		if arg2.Sign() == 0 {
+			if task.Operator == "%" {
+				return "", fmt.Errorf("modulo by zero")
+			}
+			return "", fmt.Errorf("division by zero")
+		}
+		ratio := new(big.Rat).Quo(arg1, arg2)
+		quotient := new(big.Int).Div(ratio.Num(), ratio.Denom()) // знаменатель положителен, Div округляет вниз
+		if task.Operator == "//" {
+			result.SetInt(quotient)
 		} else {
-			return 0, fmt.Errorf("division by zero")
+			result.Sub(arg1, new(big.Rat).Mul(arg2, new(big.Rat).SetInt(quotient)))
 		}
+	default:
+		return "", fmt.Errorf("unknown operator")
 	}
-	return 0, fmt.Errorf("unknown operator")
+	return result.RatString(), nil
 }
 
-func postTaskResult(id, result int, e error) {
+func postTaskResult(id int, name, result string, e error) {
 	errString := ""
 	if e != nil {
 		errString = e.Error()
@@ -83,6 +317,7 @@ func postTaskResult(id, result int, e error) {
 	}
 	resultData := map[string]interface{}{
 		"id":     id,
+		"agent":  name,
 		"result": result,
 		"error":  errString,
 	}
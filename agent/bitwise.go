@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"distributed_calculator/tasks"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+var bitwiseOperators = map[string]bool{ // побитовые операции над целыми числами
+	"&":   true,
+	"|":   true,
+	"xor": true,
+	"<<":  true,
+	">>":  true,
+}
+
+// performBitwiseTask выполняет побитовую операцию или сдвиг. Аргументы любого режима
+// должны быть целыми; отрицательные числа обрабатываются в дополнительном коде
+func performBitwiseTask(task *tasks.Task) (string, error) {
+	arg1, ok1 := new(big.Rat).SetString(task.Arg1)
+	arg2, ok2 := new(big.Rat).SetString(task.Arg2)
+	if !ok1 || !ok2 {
+		return "", fmt.Errorf("invalid arguments")
+	}
+	if !arg1.IsInt() || !arg2.IsInt() {
+		return "", fmt.Errorf("bitwise operation requires integers")
+	}
+	a, b := arg1.Num(), arg2.Num()
+
+	result := new(big.Int)
+	switch task.Operator {
+	case "&":
+		result.And(a, b)
+	case "|":
+		result.Or(a, b)
+	case "xor":
+		result.Xor(a, b)
+	case "<<", ">>":
+		if b.Sign() < 0 {
+			return "", fmt.Errorf("negative shift count")
+		}
+		if task.Operator == ">>" {
+			if b.BitLen() > 32 {
+				b = big.NewInt(int64(a.BitLen()) + 1) // сдвиг дальше длины числа дает 0 или -1
+			}
+			result.Rsh(a, uint(b.Uint64()))
+			break
+		}
+		if !b.IsInt64() || b.Int64() > maxBigIntBits-int64(a.BitLen()) {
+			return "", fmt.Errorf("result is too large")
+		}
+		result.Lsh(a, uint(b.Uint64()))
+	default:
+		return "", fmt.Errorf("unknown operator")
+	}
+
+	if task.Mode == tasks.FloatMode {
+		if _, err := strconv.ParseFloat(result.String(), 64); err != nil {
+			return "", fmt.Errorf("result out of range")
+		}
+	}
+	return result.String(), nil
+}
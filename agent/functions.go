@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"distributed_calculator/tasks"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// performFunctionTask выполняет задачу вызова встроенной функции (sqrt, abs, min, max, pow)
+func performFunctionTask(task *tasks.Task) (string, error) {
+	args := task.Args
+	switch task.Operator {
+	case "sqrt", "abs":
+		if len(args) != 1 {
+			return "", fmt.Errorf("%v expects 1 argument", task.Operator)
+		}
+	case "min", "max":
+		if len(args) == 0 {
+			return "", fmt.Errorf("%v expects at least 1 argument", task.Operator)
+		}
+	case "pow":
+		if len(args) != 2 {
+			return "", fmt.Errorf("pow expects 2 arguments")
+		}
+		// pow(a, b) вычисляется так же, как a ^ b
+		power := *task
+		power.Operator, power.Arg1, power.Arg2, power.Args = "^", args[0], args[1], nil
+		switch task.Mode {
+		case tasks.BigIntMode:
+			return performBigIntTask(&power)
+		case tasks.RationalMode:
+			return performRationalTask(&power)
+		}
+		return performFloatTask(&power)
+	default:
+		return "", fmt.Errorf("unknown function: %v", task.Operator)
+	}
+
+	switch task.Mode {
+	case tasks.BigIntMode:
+		return performBigIntFunction(task.Operator, args)
+	case tasks.RationalMode:
+		return performRationalFunction(task.Operator, args)
+	}
+	return performFloatFunction(task.Operator, args)
+}
+
+func performFloatFunction(name string, args []string) (string, error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		value, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid arguments")
+		}
+		values[i] = value
+	}
+
+	result := values[0]
+	switch name {
+	case "sqrt":
+		if result < 0 {
+			return "", fmt.Errorf("square root of negative number")
+		}
+		result = math.Sqrt(result)
+	case "abs":
+		result = math.Abs(result)
+	case "min":
+		for _, value := range values[1:] {
+			result = math.Min(result, value)
+		}
+	case "max":
+		for _, value := range values[1:] {
+			result = math.Max(result, value)
+		}
+	}
+	return formatFloat(result), nil
+}
+
+func performBigIntFunction(name string, args []string) (string, error) {
+	values := make([]*big.Int, len(args))
+	for i, arg := range args {
+		value, ok := new(big.Int).SetString(arg, 10)
+		if !ok {
+			return "", fmt.Errorf("invalid arguments")
+		}
+		values[i] = value
+	}
+
+	result := values[0]
+	switch name {
+	case "sqrt":
+		if result.Sign() < 0 {
+			return "", fmt.Errorf("square root of negative number")
+		}
+		result.Sqrt(result) // целая часть корня
+	case "abs":
+		result.Abs(result)
+	case "min":
+		for _, value := range values[1:] {
+			if value.Cmp(result) < 0 {
+				result = value
+			}
+		}
+	case "max":
+		for _, value := range values[1:] {
+			if value.Cmp(result) > 0 {
+				result = value
+			}
+		}
+	}
+	return result.String(), nil
+}
+
+func performRationalFunction(name string, args []string) (string, error) {
+	values := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		value, ok := new(big.Rat).SetString(arg)
+		if !ok {
+			return "", fmt.Errorf("invalid arguments")
+		}
+		values[i] = value
+	}
+
+	result := values[0]
+	switch name {
+	case "sqrt":
+		if result.Sign() < 0 {
+			return "", fmt.Errorf("square root of negative number")
+		}
+		num := new(big.Int).Sqrt(result.Num())
+		denom := new(big.Int).Sqrt(result.Denom())
+		if new(big.Int).Mul(num, num).Cmp(result.Num()) != 0 || new(big.Int).Mul(denom, denom).Cmp(result.Denom()) != 0 {
+			return "", fmt.Errorf("irrational result in rational mode")
+		}
+		result.SetFrac(num, denom)
+	case "abs":
+		result.Abs(result)
+	case "min":
+		for _, value := range values[1:] {
+			if value.Cmp(result) < 0 {
+				result = value
+			}
+		}
+	case "max":
+		for _, value := range values[1:] {
+			if value.Cmp(result) > 0 {
+				result = value
+			}
+		}
+	}
+	return result.RatString(), nil
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"distributed_calculator/tasks"
+	"fmt"
+	"math/big"
+)
+
+var logicalOperators = map[string]bool{ // операторы, результат которых — 1 (истина) или 0 (ложь)
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"==": true,
+	"!=": true,
+	"&&": true,
+	"||": true,
+}
+
+// performLogicalTask выполняет сравнение или логическую операцию. Аргументы любого режима
+// сравниваются как точные дроби, ненулевое число считается истиной
+func performLogicalTask(task *tasks.Task) (string, error) {
+	arg1, ok1 := new(big.Rat).SetString(task.Arg1)
+	arg2, ok2 := new(big.Rat).SetString(task.Arg2)
+	if !ok1 || !ok2 {
+		return "", fmt.Errorf("invalid arguments")
+	}
+
+	var result bool
+	switch task.Operator {
+	case "<":
+		result = arg1.Cmp(arg2) < 0
+	case "<=":
+		result = arg1.Cmp(arg2) <= 0
+	case ">":
+		result = arg1.Cmp(arg2) > 0
+	case ">=":
+		result = arg1.Cmp(arg2) >= 0
+	case "==":
+		result = arg1.Cmp(arg2) == 0
+	case "!=":
+		result = arg1.Cmp(arg2) != 0
+	case "&&":
+		result = arg1.Sign() != 0 && arg2.Sign() != 0
+	case "||":
+		result = arg1.Sign() != 0 || arg2.Sign() != 0
+	default:
+		return "", fmt.Errorf("unknown operator")
+	}
+	if result {
+		return "1", nil
+	}
+	return "0", nil
+}
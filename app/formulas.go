@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"distributed_calculator/config"
+	"distributed_calculator/evaluation"
+	"distributed_calculator/tasks"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type Formula struct { // сохраненная формула пользователя
+	ID         int      `json:"id"`
+	UserID     int      `json:"-"`
+	Name       string   `json:"name"`
+	Expression string   `json:"expression"`
+	Mode       string   `json:"mode"`
+	Variables  []string `json:"variables"` // переменные, значения которых нужно передать при вычислении
+}
+
+var formulaNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`) // имя формулы используется в URL
+
+func saveFormulaHandler(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Name       string `json:"name"`
+		Expression string `json:"expression"`
+		Mode       string `json:"mode"`
+		Token      string `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	uid, err := userIDFromToken(data.Token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return
+	}
+
+	if !formulaNamePattern.MatchString(data.Name) {
+		http.Error(w, "Invalid formula name", http.StatusBadRequest)
+		return
+	}
+	postfix, err := evaluation.InfixToPostfix(data.Expression)
+	if err != nil {
+		writeExpressionError(w, err)
+		return
+	}
+	if data.Mode == "" {
+		data.Mode = tasks.FloatMode
+	}
+	if !tasks.ValidMode(data.Mode) {
+		writeExpressionError(w, fmt.Errorf("unknown mode: %v", data.Mode))
+		return
+	}
+
+	formula := &Formula{UserID: uid, Name: data.Name, Expression: data.Expression, Mode: data.Mode}
+	formula.ID, err = saveFormula(formula)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError) // 500
+		return
+	}
+	formula.Variables = evaluation.Variables(postfix)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+	e := json.NewEncoder(w).Encode(formula)
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
+func getFormulasHandler(w http.ResponseWriter, r *http.Request) {
+	uid, err := userIDFromToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return
+	}
+
+	formulas, err := getFormulas(uid)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError) // 500
+		return
+	}
+	for _, formula := range formulas {
+		if postfix, err := evaluation.InfixToPostfix(formula.Expression); err == nil {
+			formula.Variables = evaluation.Variables(postfix)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+	e := json.NewEncoder(w).Encode(map[string][]*Formula{"formulas": formulas})
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
+func evaluateFormulaHandler(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Bindings map[string]json.Number `json:"bindings"`
+		Optimize bool                   `json:"optimize"`
+		Priority string                 `json:"priority"`
+		Deadline *time.Time             `json:"deadline"`
+		Token    string                 `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	uid, err := userIDFromToken(data.Token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return
+	}
+
+	formula, err := getFormula(uid, mux.Vars(r)["name"])
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Formula does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError) // 500
+		return
+	}
+
+	priority, err := tasks.ParsePriority(data.Priority)
+	if err != nil {
+		writeExpressionError(w, err)
+		return
+	}
+	if err := checkDeadline(data.Deadline); err != nil {
+		writeExpressionError(w, err)
+		return
+	}
+
+	bindings := bindingValues(data.Bindings)
+	root, mode, unit, err := prepareExpression(formula.Expression, evaluation.InfixNotation, formula.Mode, bindings)
+	if err != nil {
+		writeExpressionError(w, err)
+		return
+	}
+
+	root, tasksSaved := evaluation.Optimize(root, data.Optimize)
+
+	newExpression := NewExpression(uid, formula.Expression, mode)
+	newExpression.FormulaID = formula.ID
+	newExpression.Bindings = bindings
+	newExpression.Unit = unit
+	newExpression.Priority = priority
+	if data.Deadline != nil {
+		newExpression.Deadline = *data.Deadline
+	}
+	estimate := evaluation.EstimateTree(root, config.COMPUTING_POWER)
+	newExpression.EstimatedMs = estimate.EstimatedMs
+	id, err := startExpression(newExpression, root)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError) // 500
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+	e := json.NewEncoder(w).Encode(struct {
+		ID         string `json:"id"`
+		TasksSaved int    `json:"tasks_saved,omitempty"`
+
+		Estimate evaluation.Estimate `json:"estimate"` // оценка времени вычисления, как в /api/v1/calculate
+	}{ID: strconv.Itoa(id), TasksSaved: tasksSaved, Estimate: estimate})
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
+// saveFormula сохраняет формулу; формула с тем же именем у пользователя перезаписывается
+func saveFormula(formula *Formula) (int, error) {
+	var q = `
+	INSERT INTO formulas (user_id, name, expression, mode) values ($1, $2, $3, $4)
+	ON CONFLICT (user_id, name) DO UPDATE SET expression=excluded.expression, mode=excluded.mode
+	`
+	_, err := db.ExecContext(ctx, q, formula.UserID, formula.Name, formula.Expression, formula.Mode)
+	if err != nil {
+		return 0, err
+	}
+
+	saved, err := getFormula(formula.UserID, formula.Name)
+	if err != nil {
+		return 0, err
+	}
+	return saved.ID, nil
+}
+
+func getFormula(uid int, name string) (*Formula, error) {
+	var q = "SELECT id, user_id, name, expression, mode FROM formulas WHERE user_id=$1 AND name=$2"
+	formula := Formula{}
+	err := db.QueryRowContext(ctx, q, uid, name).Scan(&formula.ID, &formula.UserID, &formula.Name, &formula.Expression, &formula.Mode)
+	if err != nil {
+		return nil, err
+	}
+	return &formula, nil
+}
+
+func getFormulas(uid int) ([]*Formula, error) {
+	var q = "SELECT id, user_id, name, expression, mode FROM formulas WHERE user_id=$1 ORDER BY name"
+	rows, err := db.QueryContext(ctx, q, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	formulas := []*Formula{}
+	for rows.Next() {
+		formula := Formula{}
+		err := rows.Scan(&formula.ID, &formula.UserID, &formula.Name, &formula.Expression, &formula.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("scan formula: %w", err)
+		}
+		formulas = append(formulas, &formula)
+	}
+	return formulas, rows.Err()
+}
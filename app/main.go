@@ -9,6 +9,7 @@ import (
 	"distributed_calculator/expression_structs"
 	"distributed_calculator/tasks"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
@@ -25,7 +26,8 @@ type Expression = expression_structs.Expression
 type ExpressionItem struct { // структура выражения для вывода в API
 	ID     int
 	Status string
-	Result int
+	Result interface{} // число в режиме float, строка в точных режимах
+	Unit   string      `json:",omitempty"` // единица измерения результата
 }
 
 type Expressions = expression_structs.Expressions
@@ -51,17 +53,36 @@ func NewExpressions() *Expressions {
 	return &Expressions{Mx: &sync.Mutex{}, LastID: 0, Expressions: make(map[int]*Expression)}
 }
 
-func NewExpression(uid int, exp string) *Expression {
-	return &Expression{UserID: uid, Expression: exp, Status: "Processing"}
+func NewExpression(uid int, exp, mode string) *Expression {
+	return &Expression{UserID: uid, Expression: exp, Mode: mode, Status: "Processing", Priority: tasks.NormalPriority}
+}
+
+// resultValue возвращает результат для ответа API: в режиме float — числом,
+// в точных режимах — строкой, чтобы клиент не потерял точность
+func resultValue(expr *Expression) interface{} {
+	if expr.Mode == tasks.FloatMode {
+		return json.Number(expr.Result)
+	}
+	return expr.Result
 }
 
 func addExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	type RequestData struct {
-		Expression string `json:"expression"`
-		Token      string `json:"token"`
+		Expression string                 `json:"expression"`
+		Mode       string                 `json:"mode"`     // float (по умолчанию), bigint или rational
+		Notation   string                 `json:"notation"` // infix (по умолчанию), postfix или prefix
+		Bindings   map[string]json.Number `json:"bindings"` // значения переменных выражения
+		Optimize   bool                   `json:"optimize"` // упростить выражение перед созданием задач
+		Priority   string                 `json:"priority"` // low, normal (по умолчанию) или high
+		Deadline   *time.Time             `json:"deadline"` // RFC 3339; не посчитанное к этому времени выражение отменяется
+		Token      string                 `json:"token"`
 	}
 	type ResponseData struct {
-		ID string `json:"id"`
+		ID         string `json:"id"`
+		TasksSaved int    `json:"tasks_saved,omitempty"` // сколько задач сэкономили упрощение и объединение подвыражений
+		SourceID   int    `json:"source_id,omitempty"`   // уже посчитанное выражение, результат которого использован
+
+		Estimate *evaluation.Estimate `json:"estimate,omitempty"` // оценка времени вычисления
 	}
 	var data RequestData
 
@@ -71,80 +92,63 @@ func addExpressionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenFromString, err := jwt.Parse(data.Token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			panic(fmt.Errorf("unexpected signing method: %v", token.Header["alg"]))
-		}
-
-		return []byte(config.SECRET_KEY), nil
-	})
-
+	uid, err := userIDFromToken(data.Token)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest) // 400
 		return
 	}
 
-	uid := 0
-	var e error
-
-	if claims, ok := tokenFromString.Claims.(jwt.MapClaims); ok {
-		fmt.Println("user name: ")
-		uid, e = strconv.Atoi(fmt.Sprintf("%v", claims["name"]))
-	} else {
-		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+	priority, err := tasks.ParsePriority(data.Priority)
+	if err != nil {
+		writeExpressionError(w, err)
+		return
+	}
+	if err := checkDeadline(data.Deadline); err != nil {
+		writeExpressionError(w, err)
 		return
 	}
 
 	expression := data.Expression
-	postfix, err := evaluation.InfixToPostfix(expression)
+	bindings := bindingValues(data.Bindings)
+	root, mode, unit, err := prepareExpression(expression, data.Notation, data.Mode, bindings)
 	if err != nil {
-		http.Error(w, "Invalid expression: "+err.Error(), http.StatusBadRequest)
+		writeExpressionError(w, err)
 		return
 	}
 
-	id, e := insertExpression(NewExpression(uid, expression))
+	root, tasksSaved := evaluation.Optimize(root, data.Optimize)
 
-	fmt.Println("Postfix Expression:", strings.Join(postfix, " "))
-
-	go func(id int, postfix []string) {
-		newPostfix, err := evaluation.EvaluatePostfix(id, tasksList, postfix)
-		expressionsList.Mx.Lock()
-		defer expressionsList.Mx.Unlock()
-
-		if err != nil && err.Error() == "unready warning" {
-			err := updateExpressionPostfix(id, newPostfix)
-			if err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
-				return
-			}
-			// expression.Postfix = newPostfix
-		} else if err == nil {
-			result, _ := strconv.Atoi(newPostfix[0])
-			// expression.Result = result
-			err := updateExpressionResult(id, result)
-			if err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
-				return
-			}
-			// expression.Status = "Done"
-			err = updateExpressionStatus(id, "Done")
-			if err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
-				return
-			}
-		} else {
-			// expression.Status = "Error"
-			err := updateExpressionStatus(id, "Error")
-			if err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
-				return
-			}
-		}
-	}(id, postfix)
+	newExpression := NewExpression(uid, expression, mode)
+	newExpression.Bindings = bindings
+	newExpression.Unit = unit
+	newExpression.Priority = priority
+	if data.Deadline != nil {
+		newExpression.Deadline = *data.Deadline
+	}
+	newExpression.Normalized = evaluation.Normalize(root)
+
+	var id int
+	var estimate *evaluation.Estimate
+	source, err := findComputedExpression(mode, newExpression.Normalized)
+	if err == nil {
+		// такое же выражение уже посчитано, новое сразу получает его результат
+		id, err = storeComputedExpression(newExpression, root, source)
+		tasksSaved = 0
+	} else if errors.Is(err, sql.ErrNoRows) {
+		e := evaluation.EstimateTree(root, config.COMPUTING_POWER)
+		estimate = &e
+		newExpression.EstimatedMs = e.EstimatedMs
+		id, err = startExpression(newExpression, root)
+	}
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError) // 500
+		return
+	}
 
 	w.WriteHeader(http.StatusCreated) // 201
 	w.Header().Set("Content-Type", "application/json")
-	e = json.NewEncoder(w).Encode(&ResponseData{ID: strconv.Itoa(id)})
+	e := json.NewEncoder(w).Encode(&ResponseData{ID: strconv.Itoa(id), TasksSaved: tasksSaved, SourceID: newExpression.SourceID,
+		Estimate: estimate})
 	if e != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
 		return
@@ -152,6 +156,171 @@ func addExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println(expression)
 }
 
+// checkDeadline проверяет срок вычисления из запроса: nil — срока нет
+func checkDeadline(deadline *time.Time) error {
+	if deadline != nil && !deadline.After(time.Now()) {
+		return errors.New("deadline has already passed")
+	}
+	return nil
+}
+
+// writeExpressionError отвечает 400 с описанием ошибки выражения в JSON;
+// для ошибок разбора в ответ попадают позиция ошибки и подсказка
+func writeExpressionError(w http.ResponseWriter, err error) {
+	var response struct {
+		Error interface{} `json:"error"`
+	}
+	var parseError *evaluation.ParseError
+	if errors.As(err, &parseError) {
+		response.Error = parseError
+	} else {
+		response.Error = map[string]string{"message": err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest) // 400
+	e := json.NewEncoder(w).Encode(response)
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+	}
+}
+
+// userIDFromToken проверяет JWT-токен и возвращает id пользователя из него
+func userIDFromToken(token string) (int, error) {
+	tokenFromString, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(config.SECRET_KEY), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	claims, ok := tokenFromString.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, fmt.Errorf("invalid token claims")
+	}
+	uid, err := strconv.Atoi(fmt.Sprintf("%v", claims["uid"]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id in token")
+	}
+	return uid, nil
+}
+
+func bindingValues(values map[string]json.Number) map[string]string {
+	bindings := make(map[string]string, len(values))
+	for name, value := range values {
+		bindings[name] = value.String()
+	}
+	return bindings
+}
+
+// prepareExpression разбирает выражение в записи notation, подставляет значения переменных,
+// проверяет числа для выбранного режима, строит дерево выражения и проверяет размерности.
+// Возвращает дерево, режим и единицу измерения результата. Пустой режим означает float,
+// пустая запись — infix
+func prepareExpression(expression, notation, mode string, bindings map[string]string) (*evaluation.Node, string, string, error) {
+	postfix, err := evaluation.ParseExpression(expression, notation)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	postfix, err = evaluation.BindVariables(postfix, bindings)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if mode == "" {
+		mode = tasks.FloatMode
+	}
+	if !tasks.ValidMode(mode) {
+		return nil, "", "", fmt.Errorf("unknown mode: %v", mode)
+	}
+	if err := evaluation.CheckLiterals(postfix, mode); err != nil {
+		return nil, "", "", err
+	}
+
+	root, err := evaluation.BuildTree(postfix)
+	if err != nil {
+		return nil, "", "", err
+	}
+	// размерности проверяются до упрощения: x*0 теряет единицы x
+	unit, err := evaluation.CheckUnits(root)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return root, mode, unit, nil
+}
+
+// startExpression сохраняет выражение в БД и в очереди выражений и запускает его вычисление
+func startExpression(expr *Expression, root *evaluation.Node) (int, error) {
+	expr.Postfix = root.Postfix()
+	if expr.Normalized == "" {
+		expr.Normalized = evaluation.Normalize(root)
+	}
+	id, err := insertExpression(expr)
+	if err != nil {
+		return 0, err
+	}
+	expr.ID = id
+	expr.Graph = evaluation.NewGraph(id, expr.Mode, root, tasksList)
+	expr.Graph.UserID, expr.Graph.Priority = expr.UserID, expr.Priority
+
+	fmt.Println("Postfix Expression:", strings.Join(expr.Postfix, " "))
+
+	expressionsList.Mx.Lock()
+	expressionsList.Expressions[id] = expr
+	expressionsList.Mx.Unlock()
+
+	if !expr.Deadline.IsZero() {
+		time.AfterFunc(time.Until(expr.Deadline), func() {
+			expressionsList.Mx.Lock()
+			defer expressionsList.Mx.Unlock()
+			if expr.Status == "Processing" {
+				cancelExpression(expr, "Cancelled: deadline exceeded")
+			}
+		})
+	}
+
+	go func(expr *Expression) {
+		expressionsList.Mx.Lock()
+		defer expressionsList.Mx.Unlock()
+		if expr.Status != "Processing" {
+			return // выражение отменили раньше, чем началось вычисление
+		}
+		updateExpressionState(expr, expr.Graph.Start())
+	}(expr)
+
+	return id, nil
+}
+
+// storeComputedExpression сохраняет выражение, результат которого взят из уже посчитанного
+// выражения source, без создания задач
+func storeComputedExpression(expr *Expression, root *evaluation.Node, source *Expression) (int, error) {
+	expr.Postfix = root.Postfix()
+	expr.SourceID = source.ID
+	id, err := insertExpression(expr)
+	if err != nil {
+		return 0, err
+	}
+	expr.ID = id
+	expr.Status = "Done"
+	expr.Result = source.Result
+	if err := updateExpressionResult(id, expr.Result); err != nil {
+		return 0, err
+	}
+	if err := updateExpressionStatus(id, expr.Status); err != nil {
+		return 0, err
+	}
+
+	expressionsList.Mx.Lock()
+	expressionsList.Expressions[id] = expr
+	expressionsList.Mx.Unlock()
+	return id, nil
+}
+
 func getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 
@@ -184,7 +353,8 @@ func getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 		expressions = append(expressions, ExpressionItem{
 			ID:     value.ID,
 			Status: value.Status,
-			Result: value.Result,
+			Result: resultValue(value),
+			Unit:   value.Unit,
 		})
 	}
 	expressionsList.Mx.Unlock()
@@ -203,30 +373,14 @@ func getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getExpressionHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	token := vars["token"]
-
-	tokenFromString, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			panic(fmt.Errorf("unexpected signing method: %v", token.Header["alg"]))
-		}
-
-		return []byte(config.SECRET_KEY), nil
-	})
+	idStr := mux.Vars(r)["id"]
 
+	uid, err := userIDFromToken(r.URL.Query().Get("token"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest) // 400
 		return
 	}
 
-	if claims, ok := tokenFromString.Claims.(jwt.MapClaims); ok {
-		fmt.Println("user name: ", claims["name"])
-	} else {
-		http.Error(w, err.Error(), http.StatusBadRequest) // 400
-		return
-	}
-
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		http.Error(w, "Invalid ID", http.StatusBadRequest) // 400
@@ -234,19 +388,57 @@ func getExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	expressionsList.Mx.Lock()
 	expr, exist := expressionsList.Expressions[id]
+	var makespanMs *int64 // фактическое время вычисления, чтобы сравнить его с оценкой
+	if exist && expr.Graph != nil {
+		if makespan, done := expr.Graph.Makespan(); done {
+			ms := makespan.Milliseconds()
+			makespanMs = &ms
+		}
+	}
 	expressionsList.Mx.Unlock()
-	if !exist {
+	if !exist || expr.UserID != uid {
 		http.Error(w, "Expression does not exist", http.StatusNotFound)
 		return
 	}
+
+	result := resultValue(expr)
+	if baseStr := r.URL.Query().Get("base"); baseStr != "" && expr.Status == "Done" {
+		// результат в другой системе счисления возвращается строкой с префиксом (0xff)
+		base, err := strconv.Atoi(baseStr)
+		if err != nil {
+			http.Error(w, "Invalid base", http.StatusBadRequest) // 400
+			return
+		}
+		result, err = evaluation.FormatBase(expr.Result, base)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest) // 400
+			return
+		}
+	}
 	response := struct {
-		ID     int    `json:"id"`
-		Status string `json:"status"`
-		Result int    `json:"result"`
+		ID        int         `json:"id"`
+		Status    string      `json:"status"`
+		Result    interface{} `json:"result"`
+		Unit      string      `json:"unit,omitempty"` // единица измерения результата в СИ
+		FormulaID int         `json:"formula_id,omitempty"`
+		SourceID  int         `json:"source_id,omitempty"`
+
+		EstimatedMs int        `json:"estimated_ms,omitempty"` // оценка при создании выражения
+		MakespanMs  *int64     `json:"makespan_ms,omitempty"`  // от начала вычисления до результата
+		Deadline    *time.Time `json:"deadline,omitempty"`     // срок, после которого вычисление отменяется
 	}{
-		ID:     expr.ID,
-		Status: expr.Status,
-		Result: expr.Result,
+		ID:        expr.ID,
+		Status:    expr.Status,
+		Result:    result,
+		Unit:      expr.Unit,
+		FormulaID: expr.FormulaID,
+		SourceID:  expr.SourceID,
+
+		EstimatedMs: expr.EstimatedMs,
+		MakespanMs:  makespanMs,
+	}
+	if !expr.Deadline.IsZero() {
+		response.Deadline = &expr.Deadline
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -258,9 +450,20 @@ func getExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getCacheStatsHandler возвращает статистику кэша результатов операций
+func getCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+	e := json.NewEncoder(w).Encode(tasksList.Cache.Stats())
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
 func getTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		task, err := tasksList.GetTask(expressionsList)
+		task, err := tasksList.GetTask(r.URL.Query().Get("agent"))
 		if err != nil {
 			http.Error(w, "No task found", http.StatusNotFound)
 			return
@@ -275,7 +478,8 @@ func getTaskHandler(w http.ResponseWriter, r *http.Request) {
 	} else if r.Method == http.MethodPost {
 		var result struct {
 			ID     int    `json:"id"`
-			Result int    `json:"result"`
+			Agent  string `json:"agent"` // агент, который держит аренду задачи
+			Result string `json:"result"`
 			Error  string `json:"error"`
 		}
 		err := json.NewDecoder(r.Body).Decode(&result)
@@ -284,9 +488,9 @@ func getTaskHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		task, err := tasksList.CompleteTask(result.ID)
+		task, err := tasksList.CompleteTask(result.ID, result.Agent)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeLeaseError(w, err)
 			return
 		}
 		fmt.Println("Task ID:", result.ID)
@@ -300,15 +504,12 @@ func getTaskHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		fmt.Println(result.Error)
 		if result.Error != "" {
-			expr.Status = "Error: " + result.Error
-
-			for _, t := range tasksList.Tasks {
-				if t.ExpressionID == expr.ID {
-					_, err := tasksList.CompleteTask(t.ID)
-					if err != nil {
-						fmt.Printf("Error: %v\n", err)
-					}
+			// выражение могли отменить или завершить ошибкой другой задачи, пока агент ее выполнял
+			if expr.Status == "Processing" {
+				if expr.Graph != nil {
+					expr.Graph.Fail(task, result.Error)
 				}
+				failExpression(expr, "Error: "+result.Error)
 			}
 
 			w.WriteHeader(http.StatusOK)
@@ -320,29 +521,10 @@ func getTaskHandler(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 		}
-		for i, v := range expr.Postfix {
-			if v == "t"+strconv.Itoa(task.ID) {
-				expr.Postfix[i] = strconv.Itoa(result.Result)
-			}
+		if expr.Status == "Processing" {
+			updateExpressionState(expr, expr.Graph.Complete(task, result.Result))
 		}
 
-		go func(exprID int, tasksList *tasks.Tasks, exprPostfix []string) {
-			newPostfix, err := evaluation.EvaluatePostfix(exprID, tasksList, exprPostfix)
-			expressionsList.Mx.Lock()
-			defer expressionsList.Mx.Unlock()
-
-			expression := expressionsList.Expressions[exprID]
-			if err != nil && err.Error() == "unready warning" {
-				expression.Postfix = newPostfix
-			} else if err == nil {
-				result, _ := strconv.Atoi(newPostfix[0])
-				expression.Result = result
-				expression.Status = "Done"
-			} else {
-				expression.Status = "Error"
-			}
-		}(expr.ID, tasksList, expr.Postfix)
-
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "application/json")
 		_, e := w.Write([]byte(`{}`))
@@ -356,6 +538,138 @@ func getTaskHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// heartbeatHandler продлевает аренду задачи агентом, который ее выполняет
+func heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest) // 400
+		return
+	}
+
+	expires, err := tasksList.Heartbeat(id, r.URL.Query().Get("agent"))
+	if err != nil {
+		writeLeaseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+	e := json.NewEncoder(w).Encode(struct {
+		LeaseExpires time.Time `json:"lease_expires"`
+	}{LeaseExpires: expires})
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
+// writeLeaseError отвечает 404, если задачи уже нет в очереди (аренда истекла),
+// и 409, если аренду держит другой агент
+func writeLeaseError(w http.ResponseWriter, err error) {
+	if errors.Is(err, tasks.ErrNotLeaseOwner) {
+		http.Error(w, err.Error(), http.StatusConflict) // 409
+		return
+	}
+	http.Error(w, err.Error(), http.StatusNotFound) // 404
+}
+
+// updateExpressionState сохраняет результат выражения, если его граф посчитан,
+// или ошибку, если вычисление не удалось. Вызывается под expressionsList.Mx
+func updateExpressionState(expr *Expression, err error) {
+	if err != nil {
+		failExpression(expr, "Error: "+err.Error())
+		return
+	}
+	if !expr.Graph.Done() {
+		return
+	}
+
+	expr.Result = evaluation.FormatResult(expr.Mode, expr.Graph.Result())
+	expr.Status = "Done"
+	err = updateExpressionResult(expr.ID, expr.Result)
+	if err == nil {
+		err = updateExpressionStatus(expr.ID, expr.Status)
+	}
+	if err != nil {
+		fmt.Println("DB error:", err)
+	}
+}
+
+// failExpression завершает выражение с ошибкой и убирает его оставшиеся задачи
+// из очереди. Вызывается под expressionsList.Mx
+func failExpression(expr *Expression, status string) {
+	expr.Status = status
+	tasksList.RemoveExpressionTasks(expr.ID)
+	if err := updateExpressionStatus(expr.ID, expr.Status); err != nil {
+		fmt.Println("DB error:", err)
+	}
+}
+
+// cancelExpression останавливает вычисление выражения: задачи из очереди удаляются,
+// а результаты задач, которые уже взяли агенты, больше не принимаются (404).
+// Вызывается под expressionsList.Mx
+func cancelExpression(expr *Expression, status string) {
+	if expr.Graph != nil {
+		expr.Graph.Cancel()
+	}
+	failExpression(expr, status)
+}
+
+// cancelExpressionHandler отменяет вычисление выражения пользователя
+func cancelExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	uid, err := userIDFromToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest) // 400
+		return
+	}
+
+	expressionsList.Mx.Lock()
+	expr, exist := expressionsList.Expressions[id]
+	if !exist || expr.UserID != uid {
+		expressionsList.Mx.Unlock()
+		http.Error(w, "Expression does not exist", http.StatusNotFound)
+		return
+	}
+	if expr.Status != "Processing" {
+		status := expr.Status
+		expressionsList.Mx.Unlock()
+		http.Error(w, "Expression is already finished: "+status, http.StatusConflict) // 409
+		return
+	}
+	cancelExpression(expr, "Cancelled")
+	expressionsList.Mx.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	e := json.NewEncoder(w).Encode(struct {
+		ID     int    `json:"id"`
+		Status string `json:"status"`
+	}{ID: id, Status: "Cancelled"})
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
+// onTaskTimeout вызывается очередью задач, когда аренда задачи истекла во всех попытках:
+// ни один из агентов не выполнил задачу и не продлил аренду
+func onTaskTimeout(task *tasks.Task) {
+	expressionsList.Mx.Lock()
+	defer expressionsList.Mx.Unlock()
+
+	if expr, found := expressionsList.Expressions[task.ExpressionID]; found && expr.Status == "Processing" {
+		message := fmt.Sprintf("timeout after %d attempts", task.Attempts)
+		expr.Graph.Fail(task, message)
+		failExpression(expr, "Error: "+message)
+	}
+}
+
 func registerHandler(w http.ResponseWriter, r *http.Request) {
 	var user User
 	err := json.NewDecoder(r.Body).Decode(&user)
@@ -391,6 +705,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"name": user.Login,
+		"uid":  user.ID,
 		"nbf":  now.Unix(),
 		"exp":  now.Add(5 * time.Minute).Unix(),
 		"iat":  now.Unix(),
@@ -429,9 +744,29 @@ func createTables() error {
 		user_id INTEGER NOT NULL,
 		expression TEXT NOT NULL,
 		status TEXT,
+		mode TEXT,
+		postfix TEXT,
+		result TEXT,
+		formula_id INTEGER,
+		bindings TEXT,
+		normalized TEXT,
+		source_id INTEGER,
+		unit TEXT,
 	
 		FOREIGN KEY (user_id)  REFERENCES expressions (id)
 	);`
+
+		formulasTable = `
+	CREATE TABLE IF NOT EXISTS formulas(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		expression TEXT NOT NULL,
+		mode TEXT NOT NULL,
+
+		UNIQUE (user_id, name),
+		FOREIGN KEY (user_id)  REFERENCES users (id)
+	);`
 	)
 
 	if _, err := db.ExecContext(ctx, usersTable); err != nil {
@@ -441,15 +776,120 @@ func createTables() error {
 	if _, err := db.ExecContext(ctx, expressionsTable); err != nil {
 		return err
 	}
+	if err := migrateExpressions(); err != nil {
+		return fmt.Errorf("migrate expressions: %w", err)
+	}
+
+	if _, err := db.ExecContext(ctx, formulasTable); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// expressionColumns — столбцы, добавленные в таблицу expressions после первой версии.
+// В базу, созданную старой версией, CREATE TABLE IF NOT EXISTS их не добавит
+var expressionColumns = []struct{ name, definition string }{
+	{"postfix", "TEXT"},
+	{"result", "TEXT"},
+	{"mode", "TEXT DEFAULT 'float'"}, // выражения старой версии посчитаны в float
+	{"formula_id", "INTEGER"},
+	{"bindings", "TEXT"},
+	{"normalized", "TEXT"},
+	{"source_id", "INTEGER"},
+	{"unit", "TEXT"},
+}
+
+// migrateExpressions добавляет в существующую таблицу expressions недостающие столбцы.
+// Повторный запуск ничего не меняет
+func migrateExpressions() error {
+	columns, err := tableColumns("expressions")
+	if err != nil {
+		return err
+	}
+	if columns["result"] == "REAL" {
+		if err := resultToText(); err != nil {
+			return err
+		}
+	}
+	for _, column := range expressionColumns {
+		if _, exists := columns[column.name]; exists {
+			continue
+		}
+		q := fmt.Sprintf("ALTER TABLE expressions ADD COLUMN %s %s", column.name, column.definition)
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resultToText переводит столбец result из REAL в TEXT: результаты режимов bigint
+// и rational хранятся строкой, а столбец REAL округлил бы их до float64.
+// SQLite не меняет тип столбца, поэтому столбец пересоздается
+func resultToText() error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"ALTER TABLE expressions RENAME COLUMN result TO result_real",
+		"ALTER TABLE expressions ADD COLUMN result TEXT",
+		`UPDATE expressions SET result = CASE WHEN result_real = CAST(result_real AS INTEGER)
+			THEN CAST(CAST(result_real AS INTEGER) AS TEXT) ELSE CAST(result_real AS TEXT) END`,
+		"ALTER TABLE expressions DROP COLUMN result_real",
+	}
+	for _, q := range statements {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// tableColumns возвращает столбцы таблицы и их объявленные типы
+func tableColumns(table string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]string)
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return nil, fmt.Errorf("scan column: %w", err)
+		}
+		columns[name] = strings.ToUpper(columnType)
+	}
+	return columns, rows.Err()
+}
+
 func insertExpression(expression *Expression) (int, error) {
+	var formulaID interface{} // NULL, если выражение не создано из формулы
+	if expression.FormulaID != 0 {
+		formulaID = expression.FormulaID
+	}
+	var sourceID interface{} // NULL, если выражение посчитано само
+	if expression.SourceID != 0 {
+		sourceID = expression.SourceID
+	}
+	bindings, err := json.Marshal(expression.Bindings)
+	if err != nil {
+		return 0, err
+	}
+
 	var q = `
-	INSERT INTO expressions (expression, user_id, status) values ($1, $2, "Processing...")
+	INSERT INTO expressions (expression, user_id, mode, status, formula_id, bindings, postfix, normalized, source_id, unit)
+	values ($1, $2, $3, "Processing...", $4, $5, $6, $7, $8, $9)
 	`
-	result, err := db.ExecContext(ctx, q, expression.Expression, expression.UserID)
+	result, err := db.ExecContext(ctx, q, expression.Expression, expression.UserID, expression.Mode, formulaID, string(bindings),
+		strings.Join(expression.Postfix, " "), expression.Normalized, sourceID, expression.Unit)
 	if err != nil {
 		return 0, err
 	}
@@ -462,7 +902,7 @@ func insertExpression(expression *Expression) (int, error) {
 }
 
 func getExpression(id int) *Expression {
-	var q = "SELECT id, user_id, expression, status, result FROM expressions WHERE id=$1"
+	var q = "SELECT id, user_id, expression, mode, status, COALESCE(result, '') FROM expressions WHERE id=$1"
 	rows, err := db.QueryContext(ctx, q, id)
 	if err != nil {
 		return nil
@@ -471,7 +911,7 @@ func getExpression(id int) *Expression {
 
 	for rows.Next() {
 		expr := Expression{}
-		err := rows.Scan(&expr.ID, &expr.UserID, &expr.Expression, &expr.Status, &expr.Result)
+		err := rows.Scan(&expr.ID, &expr.UserID, &expr.Expression, &expr.Mode, &expr.Status, &expr.Result)
 		if err != nil {
 			return nil
 		}
@@ -480,13 +920,25 @@ func getExpression(id int) *Expression {
 	return nil
 }
 
-func updateExpressionPostfix(id int, postfix []string) error {
-	var q = "UPDATE expressions SET postfix=$1 WHERE id=$2"
-	_, err := db.ExecContext(ctx, q, strings.Join(postfix, " "), id)
-	return err
+// findComputedExpression ищет успешно посчитанное выражение с той же канонической записью
+// и тем же режимом. Если такого нет, возвращает sql.ErrNoRows
+func findComputedExpression(mode, normalized string) (*Expression, error) {
+	var q = `
+	SELECT id, COALESCE(source_id, id), result FROM expressions
+	WHERE mode=$1 AND normalized=$2 AND status="Done" AND result IS NOT NULL
+	ORDER BY id LIMIT 1
+	`
+	var id, sourceID int
+	expr := Expression{Mode: mode, Normalized: normalized}
+	err := db.QueryRowContext(ctx, q, mode, normalized).Scan(&id, &sourceID, &expr.Result)
+	if err != nil {
+		return nil, err
+	}
+	expr.ID = sourceID // результат связывается с исходным вычислением
+	return &expr, nil
 }
 
-func updateExpressionResult(id, result int) error {
+func updateExpressionResult(id int, result string) error {
 	var q = "UPDATE expressions SET result=$1 WHERE id=$2"
 	_, err := db.ExecContext(ctx, q, result, id)
 	return err
@@ -552,13 +1004,33 @@ func main() {
 	r.HandleFunc("/api/v1/calculate", addExpressionHandler).Methods("POST")
 	r.HandleFunc("/api/v1/expressions", getExpressionsHandler).Methods("GET")
 	r.HandleFunc("/api/v1/expressions/{id}", getExpressionHandler).Methods("GET")
+	r.HandleFunc("/api/v1/expressions/{id}", cancelExpressionHandler).Methods("DELETE")
+	r.HandleFunc("/api/v1/expressions/{id}/render", renderExpressionHandler).Methods("GET")
+	r.HandleFunc("/api/v1/expressions/{id}/plan", getPlanHandler).Methods("GET")
+	r.HandleFunc("/api/v1/explain", explainHandler).Methods("POST")
+	r.HandleFunc("/api/v1/validate", validateHandler).Methods("POST")
+	r.HandleFunc("/api/v1/render", renderHandler).Methods("POST")
+	r.HandleFunc("/api/v1/formulas", saveFormulaHandler).Methods("POST")
+	r.HandleFunc("/api/v1/formulas", getFormulasHandler).Methods("GET")
+	r.HandleFunc("/api/v1/formulas/{name}/evaluate", evaluateFormulaHandler).Methods("POST")
+	r.HandleFunc("/api/v1/cache", getCacheStatsHandler).Methods("GET")
 	r.HandleFunc("/internal/task", getTaskHandler).Methods("GET", "POST")
+	r.HandleFunc("/internal/task/{id}/heartbeat", heartbeatHandler).Methods("POST")
 
 	r.HandleFunc("/api/v1/register", registerHandler).Methods("POST")
 	r.HandleFunc("/api/v1/login", loginHandler).Methods("POST")
 
+	tasksList.OnTimeout = onTaskTimeout
+	tasksList.Lease = time.Millisecond * time.Duration(config.TASK_LEASE_MS)
+	tasksList.MaxAttempts = config.TASK_MAX_ATTEMPTS
+	tasksList.RetryBackoff = time.Millisecond * time.Duration(config.TASK_RETRY_BACKOFF_MS)
+	if err := tasksList.SetPolicy(config.SCHEDULING_POLICY); err != nil {
+		panic(err)
+	}
+	tasksList.Cache = tasks.NewResultCache(config.CACHE_SIZE, time.Millisecond*time.Duration(config.CACHE_TTL_MS))
+
 	for i := 0; i < config.COMPUTING_POWER; i++ {
-		go agent.Worker()
+		go agent.Worker(i + 1)
 	}
 
 	err = http.ListenAndServe(":8080", r)
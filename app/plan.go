@@ -0,0 +1,115 @@
+package main
+
+import (
+	"distributed_calculator/config"
+	"distributed_calculator/evaluation"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type PlanResponse struct {
+	evaluation.Plan
+	TasksSaved int `json:"tasks_saved,omitempty"` // сколько задач сэкономили упрощение и объединение подвыражений
+}
+
+func writePlan(w http.ResponseWriter, plan PlanResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+	e := json.NewEncoder(w).Encode(plan)
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
+// getPlanHandler возвращает граф задач выражения с состоянием, агентом и временем каждой задачи
+func getPlanHandler(w http.ResponseWriter, r *http.Request) {
+	uid, err := userIDFromToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest) // 400
+		return
+	}
+
+	expressionsList.Mx.Lock()
+	defer expressionsList.Mx.Unlock()
+	expr, exist := expressionsList.Expressions[id]
+	if !exist || expr.UserID != uid {
+		http.Error(w, "Expression does not exist", http.StatusNotFound)
+		return
+	}
+	if expr.Graph == nil {
+		http.Error(w, fmt.Sprintf("Expression has no tasks: its result is taken from expression %d", expr.SourceID),
+			http.StatusNotFound)
+		return
+	}
+	writePlan(w, PlanResponse{Plan: expr.Graph.Plan()})
+}
+
+// dryRun разбирает тело запроса с полями /api/v1/calculate и готовит выражение так же,
+// как при вычислении, но не запускает его. При ошибке ответ уже записан, и возвращается nil
+func dryRun(w http.ResponseWriter, r *http.Request) (*evaluation.Node, int) {
+	var data struct {
+		Expression string                 `json:"expression"`
+		Mode       string                 `json:"mode"`
+		Notation   string                 `json:"notation"`
+		Bindings   map[string]json.Number `json:"bindings"`
+		Optimize   bool                   `json:"optimize"`
+		Token      string                 `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return nil, 0
+	}
+
+	if _, err := userIDFromToken(data.Token); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return nil, 0
+	}
+
+	root, _, _, err := prepareExpression(data.Expression, data.Notation, data.Mode, bindingValues(data.Bindings))
+	if err != nil {
+		writeExpressionError(w, err)
+		return nil, 0
+	}
+	return evaluation.Optimize(root, data.Optimize)
+}
+
+// explainHandler проверяет выражение так же, как /api/v1/calculate, и возвращает граф задач,
+// которые создаст его вычисление, ничего не запуская
+func explainHandler(w http.ResponseWriter, r *http.Request) {
+	root, tasksSaved := dryRun(w, r)
+	if root == nil {
+		return
+	}
+	writePlan(w, PlanResponse{Plan: evaluation.PlanTree(root), TasksSaved: tasksSaved})
+}
+
+// validateHandler проверяет выражение и оценивает время его вычисления, не запуская его
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	root, tasksSaved := dryRun(w, r)
+	if root == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+	e := json.NewEncoder(w).Encode(struct {
+		Valid      bool                `json:"valid"`
+		TasksSaved int                 `json:"tasks_saved,omitempty"`
+		Estimate   evaluation.Estimate `json:"estimate"`
+	}{Valid: true, TasksSaved: tasksSaved, Estimate: evaluation.EstimateTree(root, config.COMPUTING_POWER)})
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
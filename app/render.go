@@ -0,0 +1,91 @@
+package main
+
+import (
+	"distributed_calculator/evaluation"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type Rendering struct { // выражение в виде для отображения
+	Infix  string `json:"infix"` // каноническая запись с минимумом скобок
+	LaTeX  string `json:"latex"`
+	MathML string `json:"mathml"`
+}
+
+func renderTree(root *evaluation.Node) Rendering {
+	return Rendering{Infix: evaluation.Infix(root), LaTeX: evaluation.LaTeX(root), MathML: evaluation.MathML(root)}
+}
+
+func writeRendering(w http.ResponseWriter, rendering Rendering) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+	e := json.NewEncoder(w).Encode(rendering)
+	if e != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+}
+
+// renderHandler возвращает переданное выражение в канонической записи, LaTeX и MathML.
+// Переменные остаются переменными, вычисление не запускается
+func renderHandler(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Expression string `json:"expression"`
+		Notation   string `json:"notation"` // infix (по умолчанию), postfix или prefix
+		Token      string `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := userIDFromToken(data.Token); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return
+	}
+
+	postfix, err := evaluation.ParseExpression(data.Expression, data.Notation)
+	if err != nil {
+		writeExpressionError(w, err)
+		return
+	}
+	root, err := evaluation.BuildTree(postfix)
+	if err != nil {
+		writeExpressionError(w, err)
+		return
+	}
+	writeRendering(w, renderTree(root))
+}
+
+// renderExpressionHandler возвращает посчитанное выражение (со значениями переменных)
+// в канонической записи, LaTeX и MathML
+func renderExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	uid, err := userIDFromToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest) // 400
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest) // 400
+		return
+	}
+	expressionsList.Mx.Lock()
+	expr, exist := expressionsList.Expressions[id]
+	expressionsList.Mx.Unlock()
+	if !exist || expr.UserID != uid {
+		http.Error(w, "Expression does not exist", http.StatusNotFound)
+		return
+	}
+
+	root, err := evaluation.BuildTree(expr.Postfix)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError) // 500
+		return
+	}
+	writeRendering(w, renderTree(root))
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"testing"
 )
 
 var (
@@ -11,35 +12,95 @@ var (
 	TIME_SUBTRACTION_MS    int
 	TIME_MULTIPLICATION_MS int
 	TIME_DIVISION_MS       int
+	TIME_POWER_MS          int // время возведения в степень, по умолчанию как у умножения
+	TIME_MODULO_MS         int // время взятия остатка, по умолчанию как у деления
+	TIME_INT_DIVISION_MS   int // время целочисленного деления, по умолчанию как у деления
+	TIME_COMPARISON_MS     int // время сравнения, по умолчанию как у сложения
+	TIME_LOGICAL_MS        int // время логических && и ||, по умолчанию как у сложения
+	TIME_BITWISE_MS        int // время побитовых операций и сдвигов, по умолчанию как у сложения
+	TIME_FUNCTION_MS       int // время вызова функции по умолчанию, по умолчанию как у умножения
+	TIME_SQRT_MS           int
+	TIME_ABS_MS            int
+	TIME_MIN_MS            int
+	TIME_MAX_MS            int
+	TIME_POW_MS            int
+	RESULT_PRECISION       int    // число знаков после запятой в результате, -1 — без округления
+	CACHE_SIZE             int    // число результатов операций в кэше, 0 — кэш отключен
+	CACHE_TTL_MS           int    // время жизни результата в кэше
+	TASK_LEASE_MS          int    // на сколько агент получает задачу; агент продлевает аренду, пока выполняет задачу
+	TASK_MAX_ATTEMPTS      int    // сколько раз выдавать задачу агентам, прежде чем завершить выражение с ошибкой
+	TASK_RETRY_BACKOFF_MS  int    // пауза перед повторной выдачей задачи, удваивается с каждой попыткой
+	SCHEDULING_POLICY      string // порядок выдачи задач одного приоритета: fifo, random или critical-path
 	SECRET_KEY             string
-	e                      error
 )
 
 func init() {
-	COMPUTING_POWER, e = strconv.Atoi(os.Getenv("COMPUTING_POWER"))
-	if e != nil {
-		panic("COMPUTING_POWER environment variable must be integer")
-	}
+	COMPUTING_POWER = requiredInt("COMPUTING_POWER", 2)
+	TIME_ADDITION_MS = requiredInt("TIME_ADDITION_MS", 100)
+	TIME_SUBTRACTION_MS = requiredInt("TIME_SUBTRACTION_MS", 100)
+	TIME_MULTIPLICATION_MS = requiredInt("TIME_MULTIPLICATIONS_MS", 200)
+	TIME_DIVISION_MS = requiredInt("TIME_DIVISIONS_MS", 200)
 
-	TIME_ADDITION_MS, e = strconv.Atoi(os.Getenv("TIME_ADDITION_MS"))
-	if e != nil {
-		panic("TIME_ADDITION_MS environment variable must be integer")
-	}
+	TIME_POWER_MS = optionalInt("TIME_POWER_MS", TIME_MULTIPLICATION_MS)
+	TIME_MODULO_MS = optionalInt("TIME_MODULO_MS", TIME_DIVISION_MS)
+	TIME_INT_DIVISION_MS = optionalInt("TIME_INT_DIVISION_MS", TIME_DIVISION_MS)
+	TIME_COMPARISON_MS = optionalInt("TIME_COMPARISON_MS", TIME_ADDITION_MS)
+	TIME_LOGICAL_MS = optionalInt("TIME_LOGICAL_MS", TIME_ADDITION_MS)
+	TIME_BITWISE_MS = optionalInt("TIME_BITWISE_MS", TIME_ADDITION_MS)
 
-	TIME_SUBTRACTION_MS, e = strconv.Atoi(os.Getenv("TIME_SUBTRACTION_MS"))
-	if e != nil {
-		panic("TIME_SUBTRACTION_MS environment variable must be integer")
-	}
+	TIME_FUNCTION_MS = optionalInt("TIME_FUNCTION_MS", TIME_MULTIPLICATION_MS)
+	TIME_SQRT_MS = optionalInt("TIME_SQRT_MS", TIME_FUNCTION_MS)
+	TIME_ABS_MS = optionalInt("TIME_ABS_MS", TIME_FUNCTION_MS)
+	TIME_MIN_MS = optionalInt("TIME_MIN_MS", TIME_FUNCTION_MS)
+	TIME_MAX_MS = optionalInt("TIME_MAX_MS", TIME_FUNCTION_MS)
+	TIME_POW_MS = optionalInt("TIME_POW_MS", TIME_FUNCTION_MS)
+
+	RESULT_PRECISION = optionalInt("RESULT_PRECISION", 10)
 
-	TIME_MULTIPLICATION_MS, e = strconv.Atoi(os.Getenv("TIME_MULTIPLICATIONS_MS"))
-	if e != nil {
-		panic("TIME_MULTIPLICATIONS_MS environment variable must be integer")
+	CACHE_SIZE = optionalInt("CACHE_SIZE", 10000)
+	CACHE_TTL_MS = optionalInt("CACHE_TTL_MS", 600000)
+
+	TASK_LEASE_MS = optionalInt("TASK_LEASE_MS", 5000)
+	if TASK_LEASE_MS <= 0 {
+		panic("TASK_LEASE_MS environment variable must be positive")
+	}
+	TASK_MAX_ATTEMPTS = optionalInt("TASK_MAX_ATTEMPTS", 3)
+	if TASK_MAX_ATTEMPTS < 1 {
+		panic("TASK_MAX_ATTEMPTS environment variable must be positive")
 	}
+	TASK_RETRY_BACKOFF_MS = optionalInt("TASK_RETRY_BACKOFF_MS", 100)
 
-	TIME_DIVISION_MS, e = strconv.Atoi(os.Getenv("TIME_DIVISIONS_MS"))
-	if e != nil {
-		panic("TIME_DIVISIONS_MS environment variable must be integer")
+	SCHEDULING_POLICY = os.Getenv("SCHEDULING_POLICY")
+	if SCHEDULING_POLICY == "" {
+		SCHEDULING_POLICY = "critical-path"
 	}
 
 	SECRET_KEY = os.Getenv("SECRET_KEY")
 }
+
+// requiredInt читает обязательную целочисленную переменную окружения. Под go test
+// незаданная переменная заменяется на testDefault, чтобы тесты пакетов не требовали окружения
+func requiredInt(name string, testDefault int) int {
+	value := os.Getenv(name)
+	if value == "" && testing.Testing() {
+		return testDefault
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		panic(name + " environment variable must be integer")
+	}
+	return result
+}
+
+// optionalInt читает необязательную целочисленную переменную окружения
+func optionalInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		panic(name + " environment variable must be integer")
+	}
+	return result
+}
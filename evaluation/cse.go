@@ -0,0 +1,58 @@
+package evaluation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EliminateCommonSubexpressions объединяет одинаковые поддеревья в один узел:
+// такое поддерево вычисляется одной задачей, а ее результат получают все узлы,
+// которые его используют. Возвращает граф и число сэкономленных задач
+func EliminateCommonSubexpressions(root *Node) (*Node, int) {
+	before := countTreeTasks(root)
+	unique := make(map[string]*Node)
+
+	var merge func(node *Node) *Node
+	merge = func(node *Node) *Node {
+		var key strings.Builder
+		fmt.Fprintf(&key, "%d|%s", node.Kind, node.Value)
+		children := make([]*Node, len(node.Children))
+		for i, child := range node.Children {
+			children[i] = merge(child)
+			fmt.Fprintf(&key, "|%p", children[i]) // одинаковые операнды уже объединены в один узел
+		}
+		if existing, exists := unique[key.String()]; exists {
+			return existing
+		}
+		node.Children = children
+		unique[key.String()] = node
+		return node
+	}
+
+	merged := merge(root)
+	linkParents(merged)
+	return merged, before - CountTasks(merged)
+}
+
+// Optimize готовит дерево к вычислению: если simplify, упрощает его (Simplify),
+// затем объединяет одинаковые поддеревья. Возвращает граф и число сэкономленных задач
+func Optimize(root *Node, simplify bool) (*Node, int) {
+	saved := 0
+	if simplify {
+		root, saved = Simplify(root)
+	}
+	root, merged := EliminateCommonSubexpressions(root)
+	return root, saved + merged
+}
+
+// countTreeTasks считает задачи так, будто общие узлы вычисляются отдельно для каждого использования
+func countTreeTasks(node *Node) int {
+	count := 0
+	if node.Kind == OperatorNode || node.Kind == FunctionNode {
+		count++
+	}
+	for _, child := range node.Children {
+		count += countTreeTasks(child)
+	}
+	return count
+}
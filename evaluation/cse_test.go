@@ -0,0 +1,37 @@
+package evaluation
+
+import "testing"
+
+func TestEliminateCommonSubexpressions(t *testing.T) {
+	tests := []struct {
+		expression string
+		saved      int
+		operations []string // задачи, которые выполняются после объединения
+	}{
+		{"(1 + 2) * (1 + 2)", 1, []string{"+", "*"}},
+		{"(1 + 2) * (1 + 2) + (1 + 2) * (1 + 2)", 4, []string{"+", "*", "+"}},
+		{"max(1 + 2, 1 + 2, 2 + 1)", 1, []string{"+", "+", "max"}},
+		{"1 + 2 * 3", 0, []string{"*", "+"}},
+	}
+	for _, test := range tests {
+		root, saved := EliminateCommonSubexpressions(parseTree(t, test.expression))
+		if saved != test.saved {
+			t.Errorf("%q: saved %d tasks, want %d", test.expression, saved, test.saved)
+		}
+		if _, operations := runGraph(t, root); len(operations) != len(test.operations) {
+			t.Errorf("%q: operations %q, want %q", test.expression, operations, test.operations)
+		}
+	}
+}
+
+func TestEliminateCommonSubexpressionsSharesNode(t *testing.T) {
+	root, _ := EliminateCommonSubexpressions(parseTree(t, "(1 + 2) * (1 + 2)"))
+	left, right := root.Children[0], root.Children[1]
+	if left != right {
+		t.Fatalf("operands of %v are not shared", root)
+	}
+	// корень использует узел дважды, и граф ждет его результата для обоих операндов
+	if len(left.Parents) != 2 || left.Parents[0] != root || left.Parents[1] != root {
+		t.Errorf("shared node has parents %v, want the root twice", left.Parents)
+	}
+}
@@ -0,0 +1,43 @@
+package evaluation
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const expectedOperand = "number, variable, function or ("
+
+type ParseError struct { // ошибка разбора выражения с указанием места
+	Message  string `json:"message"`
+	Offset   int    `json:"offset"`             // смещение в байтах от начала выражения
+	Column   int    `json:"column"`             // номер символа, начиная с 1
+	Token    string `json:"token"`              // лексема, на которой произошла ошибка; пустая в конце выражения
+	Expected string `json:"expected,omitempty"` // что ожидалось на этом месте
+	Caret    string `json:"caret"`              // выражение и строка с ^ под ошибкой
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at column %d", e.Message, e.Column)
+}
+
+func newParseError(expression string, offset int, token, message, expected string) *ParseError {
+	column := utf8.RuneCountInString(expression[:offset]) + 1
+	width := utf8.RuneCountInString(token)
+	if width == 0 {
+		width = 1
+	}
+	return &ParseError{
+		Message:  message,
+		Offset:   offset,
+		Column:   column,
+		Token:    token,
+		Expected: expected,
+		Caret:    expression + "\n" + strings.Repeat(" ", column-1) + strings.Repeat("^", width),
+	}
+}
+
+// tokenError создает ошибку, указывающую на лексему t
+func tokenError(expression string, t token, message, expected string) *ParseError {
+	return newParseError(expression, t.pos, expression[t.pos:t.end], message, expected)
+}
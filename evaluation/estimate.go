@@ -0,0 +1,237 @@
+package evaluation
+
+import (
+	"sort"
+)
+
+type Estimate struct { // оценка времени вычисления выражения
+	Tasks          int `json:"tasks"`            // сколько задач получат агенты
+	CriticalPathMs int `json:"critical_path_ms"` // самая длинная цепочка зависимых задач
+	TotalWorkMs    int `json:"total_work_ms"`    // суммарное время всех задач
+	Agents         int `json:"agents"`           // число агентов, для которого сделана оценка
+	MinimumMs      int `json:"minimum_ms"`       // быстрее выражение agents агентами не посчитать
+	EstimatedMs    int `json:"estimated_ms"`     // эвристика: время жадного расписания, если задачи не ждут в очереди других выражений
+}
+
+// taskTime возвращает время выполнения задачи узла из config; 0 — узел вычисляется без задачи
+func taskTime(node *Node) int {
+	switch node.Kind {
+	case OperatorNode:
+		return *operatorTimes[node.Value]
+	case FunctionNode:
+		return *functions[node.Value].time
+	}
+	return 0
+}
+
+type schedule struct { // операции, которые нужно выполнить для вычисления дерева
+	order []*Node           // операнды раньше использующих их узлов
+	deps  map[*Node][]*Node // узлы, которые должны быть посчитаны до узла
+	level map[*Node]int     // самый долгий путь от начала узла до результата выражения
+}
+
+// newSchedule отбирает узлы, которые нужно вычислить. У условного оператора берется
+// более долгая ветвь, и ее узлы ждут условия, поэтому оценка получается сверху
+func newSchedule(root *Node) *schedule {
+	s := &schedule{deps: make(map[*Node][]*Node), level: make(map[*Node]int)}
+
+	longest := make(map[*Node]int) // самый долгий путь от листьев до конца узла
+	var pathTo func(node *Node) int
+	pathTo = func(node *Node) int {
+		if length, known := longest[node]; known {
+			return length
+		}
+		length := 0
+		if node.Kind == ConditionalNode {
+			length = pathTo(node.Children[0]) + max(pathTo(node.Children[1]), pathTo(node.Children[2]))
+		} else {
+			for _, child := range node.Children {
+				length = max(length, pathTo(child))
+			}
+		}
+		longest[node] = length + taskTime(node)
+		return longest[node]
+	}
+
+	visited := make(map[*Node]bool)
+	var visit func(node, gate *Node)
+	visit = func(node, gate *Node) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+		children := node.Children
+		if node.Kind == ConditionalNode {
+			branch := children[1]
+			if pathTo(children[2]) > pathTo(children[1]) {
+				branch = children[2]
+			}
+			visit(children[0], gate)
+			visit(branch, children[0])
+			children = []*Node{children[0], branch}
+		} else {
+			for _, child := range children {
+				visit(child, gate)
+			}
+		}
+		s.deps[node] = append([]*Node{}, children...)
+		if gate != nil {
+			s.deps[node] = append(s.deps[node], gate)
+		}
+		s.order = append(s.order, node)
+	}
+	visit(root, nil)
+
+	for i := len(s.order) - 1; i >= 0; i-- {
+		node := s.order[i]
+		s.level[node] += taskTime(node)
+		for _, dep := range s.deps[node] {
+			s.level[dep] = max(s.level[dep], s.level[node])
+		}
+	}
+	return s
+}
+
+// remainingPaths возвращает для каждого узла самый долгий путь от начала его задачи
+// до результата выражения. В отличие от newSchedule, учитывает обе ветви условного
+// оператора: заранее неизвестно, какая из них будет вычисляться
+func remainingPaths(root *Node) map[*Node]int {
+	var order []*Node
+	walk(root, func(node *Node) {
+		order = append(order, node)
+	})
+
+	paths := make(map[*Node]int, len(order))
+	for i := len(order) - 1; i >= 0; i-- { // узлы раньше своих операндов
+		node := order[i]
+		paths[node] += taskTime(node)
+		for _, child := range node.Children {
+			paths[child] = max(paths[child], paths[node])
+		}
+	}
+	return paths
+}
+
+// EstimateTree оценивает время вычисления дерева agents агентами по времени операций из config.
+// MinimumMs — нижняя граница времени. EstimatedMs — эвристическая оценка: задачи раздаются
+// свободным агентам в порядке самого долгого оставшегося пути, а у условного оператора
+// берется более долгая ветвь, поэтому оптимальное расписание может оказаться быстрее
+func EstimateTree(root *Node, agents int) Estimate {
+	if agents < 1 {
+		agents = 1
+	}
+	s := newSchedule(root)
+	estimate := Estimate{Agents: agents, MinimumMs: lowerBound(root, agents)}
+
+	remaining := make(map[*Node]int) // сколько зависимостей узла еще не посчитано
+	for _, node := range s.order {
+		remaining[node] = len(s.deps[node])
+		estimate.CriticalPathMs = max(estimate.CriticalPathMs, s.level[node])
+		if taskTime(node) > 0 {
+			estimate.Tasks++
+			estimate.TotalWorkMs += taskTime(node)
+		}
+	}
+	consumers := make(map[*Node][]*Node)
+	for _, node := range s.order {
+		for _, dep := range s.deps[node] {
+			consumers[dep] = append(consumers[dep], node)
+		}
+	}
+
+	type running struct {
+		node *Node
+		end  int
+	}
+	var ready []*Node
+	var inProgress []running
+	now := 0
+
+	var complete func(node *Node)
+	complete = func(node *Node) {
+		for _, consumer := range consumers[node] {
+			remaining[consumer]--
+			if remaining[consumer] == 0 {
+				if taskTime(consumer) == 0 {
+					complete(consumer) // узел без задачи вычисляется сразу
+				} else {
+					ready = append(ready, consumer)
+				}
+			}
+		}
+	}
+	for _, node := range s.order {
+		if len(s.deps[node]) == 0 {
+			if taskTime(node) == 0 {
+				complete(node)
+			} else {
+				ready = append(ready, node)
+			}
+		}
+	}
+
+	for len(ready) > 0 || len(inProgress) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool { return s.level[ready[i]] > s.level[ready[j]] })
+		for len(ready) > 0 && len(inProgress) < agents {
+			inProgress = append(inProgress, running{node: ready[0], end: now + taskTime(ready[0])})
+			ready = ready[1:]
+		}
+
+		next := 0
+		for i := range inProgress {
+			if inProgress[i].end < inProgress[next].end {
+				next = i
+			}
+		}
+		finished := inProgress[next]
+		inProgress = append(inProgress[:next], inProgress[next+1:]...)
+		now = finished.end
+		complete(finished.node)
+	}
+	estimate.EstimatedMs = now
+	return estimate
+}
+
+// lowerBound возвращает время, быстрее которого дерево не посчитать agents агентами:
+// max(самая короткая возможная цепочка зависимых задач, ceil(обязательная работа / agents)).
+// У условного оператора цепочка идет через более быструю ветвь, а в обязательную работу
+// входят только узлы вне ветвей: какая из ветвей понадобится, заранее неизвестно
+func lowerBound(root *Node, agents int) int {
+	shortest := make(map[*Node]int) // самый короткий путь от листьев до конца узла
+	var pathTo func(node *Node) int
+	pathTo = func(node *Node) int {
+		if length, known := shortest[node]; known {
+			return length
+		}
+		length := 0
+		if node.Kind == ConditionalNode {
+			length = pathTo(node.Children[0]) + min(pathTo(node.Children[1]), pathTo(node.Children[2]))
+		} else {
+			for _, child := range node.Children {
+				length = max(length, pathTo(child))
+			}
+		}
+		shortest[node] = length + taskTime(node)
+		return shortest[node]
+	}
+
+	work := 0
+	visited := make(map[*Node]bool)
+	var visit func(node *Node)
+	visit = func(node *Node) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+		work += taskTime(node)
+		children := node.Children
+		if node.Kind == ConditionalNode {
+			children = children[:1]
+		}
+		for _, child := range children {
+			visit(child)
+		}
+	}
+	visit(root)
+	return max(pathTo(root), (work+agents-1)/agents)
+}
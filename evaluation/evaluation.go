@@ -4,148 +4,367 @@ import (
 	"distributed_calculator/config"
 	"distributed_calculator/tasks"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
-var precedence = map[rune]int{
-	'+': 1,
-	'>': 1,
-	'*': 2,
-	'/': 2,
+const (
+	conditionalOpen = "?"  // условный оператор в стеке операторов, для которого еще не встретилось ':'
+	conditional     = "?:" // условный оператор cond ? a : b в постфиксной записи
+)
+
+var precedence = map[string]int{
+	conditionalOpen: 0,
+	conditional:     0,
+	"||":            1,
+	"&&":            2,
+	"|":             3,
+	xor:             4,
+	"&":             5,
+	"==":            6,
+	"!=":            6,
+	"<":             7,
+	"<=":            7,
+	">":             7,
+	">=":            7,
+	"<<":            8,
+	">>":            8,
+	"+":             9,
+	"-":             9,
+	"*":             10,
+	"/":             10,
+	"%":             10,
+	"//":            10,
+	unaryMinus:      11,
+	"^":             12,
 }
 
-var associativity = map[rune]string{
-	'+': "L",
-	'>': "L",
-	'*': "L",
-	'/': "L",
+var associativity = map[string]string{
+	conditionalOpen: "R",
+	conditional:     "R",
+	"||":            "L",
+	"&&":            "L",
+	"|":             "L",
+	xor:             "L",
+	"&":             "L",
+	"==":            "L",
+	"!=":            "L",
+	"<":             "L",
+	"<=":            "L",
+	">":             "L",
+	">=":            "L",
+	"<<":            "L",
+	">>":            "L",
+	"+":             "L",
+	"-":             "L",
+	"*":             "L",
+	"/":             "L",
+	"%":             "L",
+	"//":            "L",
+	unaryMinus:      "R",
+	"^":             "R",
 }
 
 func InfixToPostfix(expression string) ([]string, error) {
 	var output []string
-	var operatorStack []rune
+	var operatorStack []string
+
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, newParseError(expression, len(expression), "", "empty expression", expectedOperand)
+	}
 
-	expression = strings.ReplaceAll(expression, "-", ">") // для лучшей обработки отрицательных чисел
+	type frame struct { // открытая скобка: группирующая или вызов функции
+		function string // имя функции, пустое для обычных скобок
+		name     token  // лексема имени функции
+		open     token  // лексема открывающей скобки
+		args     int    // число уже прочитанных аргументов функции
+	}
+	var frames []frame
 
-	for _, token := range expression {
-		switch {
-		case unicode.IsDigit(token):
-			output = append(output, string(token))
-		case token == '+' || token == '>' || token == '*' || token == '/':
+	expectOperand := true // ожидается число, открывающая скобка или унарный минус
+	for i, token := range tokens {
+		switch token.kind {
+		case identifierToken:
+			if !expectOperand {
+				return nil, tokenError(expression, token, "unexpected identifier: "+token.value, "operator or )")
+			}
+			if i+1 >= len(tokens) || tokens[i+1].kind != leftParenToken {
+				// имя без скобок — переменная, ее значение подставляется в BindVariables
+				output = append(output, token.value)
+				expectOperand = false
+				continue
+			}
+			if _, exists := functions[token.value]; !exists {
+				return nil, tokenError(expression, token, "unknown function: "+token.value, "one of "+functionNames())
+			}
+		case commaToken:
+			if expectOperand {
+				return nil, tokenError(expression, token, "unexpected comma", expectedOperand)
+			}
+			for len(operatorStack) > 0 && operatorStack[len(operatorStack)-1] != "(" {
+				if operatorStack[len(operatorStack)-1] == conditionalOpen {
+					return nil, tokenError(expression, token, "unexpected comma", ":")
+				}
+				output = append(output, operatorStack[len(operatorStack)-1])
+				operatorStack = operatorStack[:len(operatorStack)-1]
+			}
+			if len(frames) == 0 || frames[len(frames)-1].function == "" {
+				return nil, tokenError(expression, token, "unexpected comma", "operator or )")
+			}
+			frames[len(frames)-1].args++
+			expectOperand = true
+		case numberToken:
+			if !expectOperand {
+				return nil, tokenError(expression, token, "unexpected number: "+token.value, "operator or )")
+			}
+			output = append(output, token.value)
+			expectOperand = false
+		case unitToken:
+			if _, known := lookupUnit(token.value); !known {
+				return nil, tokenError(expression, token, "unknown unit: "+token.value, "operator or one of "+unitNames())
+			}
+			output = append(output, unitPostfix(token.value))
+		case unaryMinusToken:
+			operatorStack = append(operatorStack, token.value)
+		case operatorToken:
+			if expectOperand {
+				return nil, tokenError(expression, token, "unexpected operator: "+token.value, expectedOperand)
+			}
 			for len(operatorStack) > 0 {
 				top := operatorStack[len(operatorStack)-1]
-				if top == '(' {
+				if top == "(" {
 					break
 				}
-				if (associativity[token] == "L" && precedence[token] <= precedence[top]) ||
-					(associativity[token] == "R" && precedence[token] < precedence[top]) {
-					output = append(output, string(top))
+				if (associativity[token.value] == "L" && precedence[token.value] <= precedence[top]) ||
+					(associativity[token.value] == "R" && precedence[token.value] < precedence[top]) {
+					output = append(output, top)
 					operatorStack = operatorStack[:len(operatorStack)-1]
 				} else {
 					break
 				}
 			}
-			operatorStack = append(operatorStack, token)
-		case token == '(':
-			operatorStack = append(operatorStack, token)
-		case token == ')':
-			for len(operatorStack) > 0 && operatorStack[len(operatorStack)-1] != '(' {
-				output = append(output, string(operatorStack[len(operatorStack)-1]))
+			operatorStack = append(operatorStack, token.value)
+			expectOperand = true
+		case colonToken:
+			if expectOperand {
+				return nil, tokenError(expression, token, "unexpected colon", expectedOperand)
+			}
+			// ветвь "тогда" закончилась: выталкиваем ее операторы до парного '?'
+			for len(operatorStack) > 0 && operatorStack[len(operatorStack)-1] != "(" &&
+				operatorStack[len(operatorStack)-1] != conditionalOpen {
+				output = append(output, operatorStack[len(operatorStack)-1])
+				operatorStack = operatorStack[:len(operatorStack)-1]
+			}
+			if len(operatorStack) == 0 || operatorStack[len(operatorStack)-1] != conditionalOpen {
+				return nil, tokenError(expression, token, "unexpected colon", "operator or ?")
+			}
+			operatorStack[len(operatorStack)-1] = conditional
+			expectOperand = true
+		case leftParenToken:
+			if !expectOperand {
+				return nil, tokenError(expression, token, "unexpected parenthesis", "operator or )")
+			}
+			operatorStack = append(operatorStack, token.value)
+			if i > 0 && tokens[i-1].kind == identifierToken {
+				frames = append(frames, frame{function: tokens[i-1].value, name: tokens[i-1], open: token})
+			} else {
+				frames = append(frames, frame{open: token})
+			}
+		case rightParenToken:
+			if expectOperand {
+				return nil, tokenError(expression, token, "unexpected parenthesis", expectedOperand)
+			}
+			for len(operatorStack) > 0 && operatorStack[len(operatorStack)-1] != "(" {
+				if operatorStack[len(operatorStack)-1] == conditionalOpen {
+					return nil, tokenError(expression, token, "unexpected parenthesis", ":")
+				}
+				output = append(output, operatorStack[len(operatorStack)-1])
 				operatorStack = operatorStack[:len(operatorStack)-1]
 			}
 			if len(operatorStack) == 0 {
-				return nil, fmt.Errorf("mismatched parentheses")
+				return nil, tokenError(expression, token, "mismatched parentheses", "operator or end of expression")
 			}
 			operatorStack = operatorStack[:len(operatorStack)-1]
-		default:
-			return nil, fmt.Errorf("invalid token: %v", string(token))
+
+			call := frames[len(frames)-1]
+			frames = frames[:len(frames)-1]
+			if call.function != "" {
+				if err := checkArity(call.function, call.args+1); err != nil {
+					return nil, newParseError(expression, call.name.pos, expression[call.name.pos:token.end], err.Error(),
+						arityHint(call.function))
+				}
+				output = append(output, functionToken(call.function, call.args+1))
+			}
 		}
 	}
+	if expectOperand {
+		return nil, newParseError(expression, len(expression), "", "unexpected end of expression", expectedOperand)
+	}
+	if len(frames) > 0 {
+		return nil, tokenError(expression, frames[len(frames)-1].open, "mismatched parentheses", ")")
+	}
 
 	for len(operatorStack) > 0 {
-		if operatorStack[len(operatorStack)-1] == '(' {
-			return nil, fmt.Errorf("mismatched parentheses")
+		if operatorStack[len(operatorStack)-1] == conditionalOpen {
+			return nil, newParseError(expression, len(expression), "", "unexpected end of expression", ":")
 		}
-		output = append(output, string(operatorStack[len(operatorStack)-1]))
+		output = append(output, operatorStack[len(operatorStack)-1])
 		operatorStack = operatorStack[:len(operatorStack)-1]
 	}
 
 	return output, nil
 }
 
-func EvaluatePostfix(expressionID int, tasks *tasks.Tasks, originalPostfix []string) ([]string, error) {
-	postfix := make([]string, len(originalPostfix))
-	copy(postfix, originalPostfix)
+// FormatNumber записывает число в постфикс без потери точности
+func FormatNumber(value float64) string {
+	if value == 0 {
+		return "0" // -0 и округленные до нуля отрицательные числа выводятся без знака
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
 
-	fmt.Println("INPUT POSTFIX:", postfix)
-	if len(postfix) == 1 {
-		return postfix, nil
+// RoundResult округляет итоговый результат выражения до config.RESULT_PRECISION знаков после запятой
+func RoundResult(value float64) float64 {
+	if config.RESULT_PRECISION < 0 {
+		return value
+	}
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(value, 'f', config.RESULT_PRECISION, 64), 64)
+	if err != nil {
+		return value
 	}
+	return rounded
+}
+
+func isVariable(token string) bool {
+	_, isOperator := precedence[token] // xor записывается как имя, но это оператор
+	return isIdentifierChar(token, 0, true) && !strings.Contains(token, ":") && !isOperator
+}
 
-	var stack []string
-	i := 0
-	for {
-		if i >= len(postfix) {
-			break
+// Variables возвращает имена переменных постфиксного выражения в порядке первого появления
+func Variables(postfix []string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, token := range postfix {
+		if isVariable(token) && !seen[token] {
+			seen[token] = true
+			names = append(names, token)
 		}
-		fmt.Println(stack, i, postfix)
-		switch postfix[i] {
-		case "+", ">", "*", "/":
-			if len(stack) < 2 {
-				stack = []string{}
-				i++
-				continue
-			}
-			b, errB := strconv.Atoi(stack[len(stack)-1])
-			if errB != nil {
-				i++
-				continue
-			}
-			stack = stack[:len(stack)-1]
+	}
+	return names
+}
 
-			a, errA := strconv.Atoi(stack[len(stack)-1])
-			if errA != nil {
-				i++
-				continue
-			}
-			stack = stack[:len(stack)-1]
+// BindVariables подставляет значения переменных в постфиксное выражение.
+// Если хотя бы одна переменная не задана, возвращает ошибку со списком всех незаданных
+func BindVariables(postfix []string, bindings map[string]string) ([]string, error) {
+	var unbound []string
+	for _, name := range Variables(postfix) {
+		if _, exists := bindings[name]; !exists {
+			unbound = append(unbound, name)
+		}
+	}
+	if len(unbound) > 0 {
+		return nil, fmt.Errorf("unbound variables: %v", strings.Join(unbound, ", "))
+	}
 
-			taskID := "0"
+	bound := make([]string, len(postfix))
+	for i, token := range postfix {
+		if isVariable(token) {
+			token = bindings[token]
+		}
+		bound[i] = token
+	}
+	return bound, nil
+}
 
-			switch postfix[i] {
-			case "+":
-				taskID = tasks.AddTask(config.TIME_ADDITION_MS, expressionID, "+", a, b)
-			case ">":
-				taskID = tasks.AddTask(config.TIME_SUBTRACTION_MS, expressionID, "-", a, b)
-			case "*":
-				taskID = tasks.AddTask(config.TIME_MULTIPLICATION_MS, expressionID, "*", a, b)
-			case "/":
-				taskID = tasks.AddTask(config.TIME_DIVISION_MS, expressionID, "/", a, b)
+// CheckLiterals проверяет, что режим вычислений известен и все числа
+// постфиксного выражения в нём представимы
+func CheckLiterals(postfix []string, mode string) error {
+	for _, token := range postfix {
+		if _, isOperator := precedence[token]; isOperator {
+			continue
+		}
+		if _, _, isFunction := parseFunctionToken(token); isFunction {
+			continue
+		}
+		if _, isUnit := parseUnitToken(token); isUnit {
+			continue
+		}
+		switch mode {
+		case tasks.FloatMode:
+			if _, err := strconv.ParseFloat(token, 64); err != nil {
+				return fmt.Errorf("invalid number: %v", token)
 			}
-			postfix = append(postfix[:i+1], append([]string{"t" + taskID}, postfix[i+1:]...)...)
-
-			for j := i; j >= i-2; j-- {
-				if j+1 == len(postfix) {
-					postfix = postfix[:j]
-				} else {
-					postfix = append(postfix[:j], postfix[j+1:]...)
-				}
+		case tasks.BigIntMode:
+			if _, ok := new(big.Int).SetString(token, 10); !ok {
+				return fmt.Errorf("%v is not an integer", token)
 			}
-			i -= 1
-		default:
-			num, err := strconv.Atoi(postfix[i])
-			if err != nil {
-				stack = []string{}
-				i++
-				continue
+		case tasks.RationalMode:
+			if _, ok := new(big.Rat).SetString(token); !ok {
+				return fmt.Errorf("invalid number: %v", token)
 			}
-			stack = append(stack, strconv.Itoa(num))
-			i++
+		default:
+			return fmt.Errorf("unknown mode: %v", mode)
+		}
+	}
+	return nil
+}
+
+// FormatResult приводит посчитанное значение к виду, в котором оно возвращается пользователю
+func FormatResult(mode, value string) string {
+	switch mode {
+	case tasks.BigIntMode:
+		if num, ok := new(big.Int).SetString(value, 10); ok {
+			return num.String()
+		}
+	case tasks.RationalMode:
+		if num, ok := new(big.Rat).SetString(value); ok {
+			return num.RatString()
+		}
+	default:
+		if num, err := strconv.ParseFloat(value, 64); err == nil {
+			return FormatNumber(RoundResult(num))
 		}
 	}
+	return value
+}
 
-	fmt.Println(stack)
-	return postfix, fmt.Errorf("unready warning")
+// FormatBase записывает целый результат в системе счисления base (2, 8, 10 или 16)
+// с префиксом, как в литералах выражений: 255 в base 16 — 0xff
+func FormatBase(value string, base int) (string, error) {
+	number, ok := new(big.Rat).SetString(value)
+	if !ok || !number.IsInt() {
+		return "", fmt.Errorf("result %v is not an integer", value)
+	}
+	prefix, exists := map[int]string{2: "0b", 8: "0o", 10: "", 16: "0x"}[base]
+	if !exists {
+		return "", fmt.Errorf("unsupported base: %d", base)
+	}
+	integer := number.Num()
+	if integer.Sign() < 0 {
+		return "-" + prefix + new(big.Int).Neg(integer).Text(base), nil
+	}
+	return prefix + integer.Text(base), nil
+}
+
+// isTrue сообщает, является ли значение истинным условием: истинно любое ненулевое число
+func isTrue(value string) bool {
+	number, ok := new(big.Rat).SetString(value)
+	return ok && number.Sign() != 0
+}
+
+// negate меняет знак числа, записанного строкой. Ноль остается нулем без знака,
+// иначе -(1-1) дало бы -0, а ключ кэша и каноническая запись отличались бы от 0
+func negate(value string) string {
+	if number, ok := new(big.Rat).SetString(value); ok && number.Sign() == 0 {
+		return "0"
+	}
+	if strings.HasPrefix(value, "-") {
+		return value[1:]
+	}
+	return "-" + value
 }
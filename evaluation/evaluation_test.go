@@ -0,0 +1,63 @@
+package evaluation
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestInfixToPostfix(t *testing.T) {
+	tests := []struct {
+		expression string
+		postfix    []string
+	}{
+		{"2+3*4", []string{"2", "3", "4", "*", "+"}},
+		{"(2 + 3) * 4", []string{"2", "3", "+", "4", "*"}},
+		{"2^3^2", []string{"2", "3", "2", "^", "^"}},
+		{"-2^2", []string{"2", "2", "^", "~"}},
+		{"-x", []string{"x", "~"}},
+		{"1 - -2", []string{"1", "-2", "-"}},
+		{"2 // 3 % 4", []string{"2", "3", "//", "4", "%"}},
+		{"1 < 2 && 3 xor 4", []string{"1", "2", "<", "3", "4", "xor", "&&"}},
+		{"a ? b : c", []string{"a", "b", "c", "?:"}},
+		{"max(1, 2, 3)", []string{"1", "2", "3", "max:3"}},
+		{"sqrt(4) + abs(-1)", []string{"4", "sqrt:1", "-1", "abs:1", "+"}},
+		{"5 km + 300 m", []string{"5", "[km]", "300", "[m]", "+"}},
+	}
+	for _, test := range tests {
+		postfix, err := InfixToPostfix(test.expression)
+		if err != nil {
+			t.Errorf("InfixToPostfix(%q): %v", test.expression, err)
+			continue
+		}
+		if !slices.Equal(postfix, test.postfix) {
+			t.Errorf("InfixToPostfix(%q) = %q, want %q", test.expression, postfix, test.postfix)
+		}
+	}
+}
+
+func TestInfixToPostfixErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		message    string
+		column     int
+	}{
+		{"2 +", "unexpected end of expression", 4},
+		{"(1", "mismatched parentheses", 1},
+		{"max(", "unexpected end of expression", 5},
+		{"1 2", "unexpected number: 2", 3},
+		{"5 min", "unknown unit: min", 3},
+	}
+	for _, test := range tests {
+		_, err := InfixToPostfix(test.expression)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("InfixToPostfix(%q): got error %v, want ParseError", test.expression, err)
+			continue
+		}
+		if parseErr.Message != test.message || parseErr.Column != test.column {
+			t.Errorf("InfixToPostfix(%q): got %q at column %d, want %q at column %d",
+				test.expression, parseErr.Message, parseErr.Column, test.message, test.column)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package evaluation
+
+import (
+	"distributed_calculator/config"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type function struct { // описание встроенной функции
+	minArgs int
+	maxArgs int  // -1 — число аргументов не ограничено
+	time    *int // время выполнения из config
+}
+
+var functions = map[string]function{
+	"sqrt": {minArgs: 1, maxArgs: 1, time: &config.TIME_SQRT_MS},
+	"abs":  {minArgs: 1, maxArgs: 1, time: &config.TIME_ABS_MS},
+	"min":  {minArgs: 1, maxArgs: -1, time: &config.TIME_MIN_MS},
+	"max":  {minArgs: 1, maxArgs: -1, time: &config.TIME_MAX_MS},
+	"pow":  {minArgs: 2, maxArgs: 2, time: &config.TIME_POW_MS},
+}
+
+func checkArity(name string, args int) error {
+	fn := functions[name]
+	if args < fn.minArgs || (fn.maxArgs >= 0 && args > fn.maxArgs) {
+		switch {
+		case fn.maxArgs == fn.minArgs:
+			return fmt.Errorf("%v expects %d argument(s), got %d", name, fn.minArgs, args)
+		case fn.maxArgs < 0:
+			return fmt.Errorf("%v expects at least %d argument(s), got %d", name, fn.minArgs, args)
+		default:
+			return fmt.Errorf("%v expects %d to %d arguments, got %d", name, fn.minArgs, fn.maxArgs, args)
+		}
+	}
+	return nil
+}
+
+func arityHint(name string) string {
+	fn := functions[name]
+	switch {
+	case fn.maxArgs == fn.minArgs:
+		return fmt.Sprintf("%d argument(s)", fn.minArgs)
+	case fn.maxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", fn.minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", fn.minArgs, fn.maxArgs)
+}
+
+func functionNames() string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// вызов функции записывается в постфиксе как имя:число_аргументов, например min:3
+func functionToken(name string, args int) string {
+	return name + ":" + strconv.Itoa(args)
+}
+
+func parseFunctionToken(token string) (string, int, bool) {
+	name, args, found := strings.Cut(token, ":")
+	if !found {
+		return "", 0, false
+	}
+	if _, exists := functions[name]; !exists {
+		return "", 0, false
+	}
+	count, err := strconv.Atoi(args)
+	if err != nil {
+		return "", 0, false
+	}
+	return name, count, true
+}
@@ -0,0 +1,367 @@
+package evaluation
+
+import (
+	"distributed_calculator/config"
+	"distributed_calculator/tasks"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type NodeKind int
+
+const (
+	NumberNode      NodeKind = iota // число
+	VariableNode                    // переменная, значение которой еще не подставлено
+	OperatorNode                    // бинарный оператор
+	NegateNode                      // унарный минус, вычисляется без создания задачи
+	FunctionNode                    // вызов встроенной функции
+	ConditionalNode                 // cond ? a : b, вычисляется только выбранная ветвь
+	UnitNode                        // число в единицах измерения, переводится в СИ без создания задачи
+)
+
+type Node struct { // узел графа выражения
+	Kind     NodeKind
+	Value    string  // число, имя переменной, оператор, имя функции или единица измерения
+	Children []*Node // операнды или аргументы функции
+	Parents  []*Node // узлы, которые используют значение этого узла
+	TaskID   int     // задача, вычисляющая значение узла; 0 — задача не создана
+	Result   string  // значение узла, когда Done
+	Done     bool
+
+	active  bool // значение узла нужно для результата, и узел ждет своих операндов
+	waiting int  // число еще не посчитанных операндов
+
+	// сведения для плана вычисления (Plan)
+	cached   bool      // результат взят из кэша, задача не создавалась
+	agent    string    // агент, выполнивший задачу
+	attempts int       // сколько раз задача выдавалась агентам
+	created  time.Time // когда создана задача
+	leased   time.Time // когда агент взял задачу
+	finished time.Time // когда стало известно значение узла
+	err      string    // ошибка, с которой агент не выполнил задачу
+}
+
+type Graph struct { // граф вычисления одного выражения
+	ExpressionID int
+	UserID       int // владелец выражения: очередь задач распределяет агентов между пользователями
+	Priority     int // вес задач выражения в очереди (tasks.ParsePriority)
+	Mode         string
+	Root         *Node
+
+	tasks    map[int]*Node // задачи, результата которых ждет граф
+	taskList *tasks.Tasks
+	failed   bool          // вычисление остановлено из-за ошибки задачи или отменено
+	paths    map[*Node]int // самый долгий путь от узла до результата, по нему очередь выбирает задачи
+	started  time.Time
+}
+
+var operatorTimes = map[string]*int{ // время выполнения операторов из config
+	"+":  &config.TIME_ADDITION_MS,
+	"-":  &config.TIME_SUBTRACTION_MS,
+	"*":  &config.TIME_MULTIPLICATION_MS,
+	"/":  &config.TIME_DIVISION_MS,
+	"^":  &config.TIME_POWER_MS,
+	"%":  &config.TIME_MODULO_MS,
+	"//": &config.TIME_INT_DIVISION_MS,
+	"<":  &config.TIME_COMPARISON_MS,
+	"<=": &config.TIME_COMPARISON_MS,
+	">":  &config.TIME_COMPARISON_MS,
+	">=": &config.TIME_COMPARISON_MS,
+	"==": &config.TIME_COMPARISON_MS,
+	"!=": &config.TIME_COMPARISON_MS,
+	"&&": &config.TIME_LOGICAL_MS,
+	"||": &config.TIME_LOGICAL_MS,
+	"&":  &config.TIME_BITWISE_MS,
+	"|":  &config.TIME_BITWISE_MS,
+	xor:  &config.TIME_BITWISE_MS,
+	"<<": &config.TIME_BITWISE_MS,
+	">>": &config.TIME_BITWISE_MS,
+}
+
+func newNode(kind NodeKind, value string, children ...*Node) *Node {
+	node := &Node{Kind: kind, Value: value, Children: children}
+	for _, child := range children {
+		child.Parents = append(child.Parents, node)
+	}
+	return node
+}
+
+// BuildTree строит дерево выражения из постфиксной записи, проверяя,
+// что каждому оператору хватает операндов и в конце остается ровно одно значение
+func BuildTree(postfix []string) (*Node, error) {
+	var stack []*Node
+	pop := func(count int, token string) ([]*Node, error) {
+		if len(stack) < count {
+			return nil, fmt.Errorf("not enough operands for %v", token)
+		}
+		operands := make([]*Node, count)
+		copy(operands, stack[len(stack)-count:])
+		stack = stack[:len(stack)-count]
+		return operands, nil
+	}
+
+	for _, token := range postfix {
+		var node *Node
+		switch {
+		case token == unaryMinus:
+			operands, err := pop(1, token)
+			if err != nil {
+				return nil, err
+			}
+			node = newNode(NegateNode, token, operands...)
+		case token == conditional:
+			operands, err := pop(3, token)
+			if err != nil {
+				return nil, err
+			}
+			node = newNode(ConditionalNode, token, operands...)
+		case operatorTimes[token] != nil:
+			operands, err := pop(2, token)
+			if err != nil {
+				return nil, err
+			}
+			node = newNode(OperatorNode, token, operands...)
+		default:
+			if name, argsCount, isFunction := parseFunctionToken(token); isFunction {
+				if err := checkArity(name, argsCount); err != nil {
+					return nil, err
+				}
+				args, err := pop(argsCount, name)
+				if err != nil {
+					return nil, err
+				}
+				node = newNode(FunctionNode, name, args...)
+			} else if name, isUnit := parseUnitToken(token); isUnit {
+				operands, err := pop(1, token)
+				if err != nil {
+					return nil, err
+				}
+				if kind := operands[0].Kind; kind != NumberNode && kind != VariableNode {
+					return nil, fmt.Errorf("unit %v must follow a number or variable", name)
+				}
+				node = newNode(UnitNode, name, operands...)
+			} else if isVariable(token) {
+				node = newNode(VariableNode, token)
+			} else {
+				node = newNode(NumberNode, token)
+			}
+		}
+		stack = append(stack, node)
+	}
+
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("expression must produce exactly one value, got %d", len(stack))
+	}
+	return stack[0], nil
+}
+
+// Postfix возвращает постфиксную запись поддерева
+func (n *Node) Postfix() []string {
+	var postfix []string
+	for _, child := range n.Children {
+		postfix = append(postfix, child.Postfix()...)
+	}
+	switch n.Kind {
+	case FunctionNode:
+		return append(postfix, functionToken(n.Value, len(n.Children)))
+	case UnitNode:
+		return append(postfix, unitPostfix(n.Value))
+	}
+	return append(postfix, n.Value)
+}
+
+func (n *Node) String() string {
+	return strings.Join(n.Postfix(), " ")
+}
+
+func NewGraph(expressionID int, mode string, root *Node, taskList *tasks.Tasks) *Graph {
+	return &Graph{ExpressionID: expressionID, Mode: mode, Root: root, tasks: make(map[int]*Node), taskList: taskList}
+}
+
+// Start создает задачи для всех операций, операнды которых уже известны.
+// Остальные задачи создаются в Complete по мере готовности операндов
+func (g *Graph) Start() error {
+	g.started = time.Now()
+	g.paths = remainingPaths(g.Root)
+	return g.activate(g.Root)
+}
+
+// Complete записывает результат задачи в граф и создает задачи,
+// которые стали готовы к выполнению
+func (g *Graph) Complete(task *tasks.Task, result string) error {
+	node, exists := g.tasks[task.ID]
+	if !exists {
+		return fmt.Errorf("task %d does not belong to expression %d", task.ID, g.ExpressionID)
+	}
+	delete(g.tasks, task.ID)
+	node.agent, node.leased, node.attempts = task.Agent, task.LeasedAt, task.Attempts
+	g.taskList.Cache.Put(g.cacheKey(node), result)
+	return g.finish(node, result)
+}
+
+// Fail отмечает задачу, которую агент не выполнил, и останавливает вычисление графа
+func (g *Graph) Fail(task *tasks.Task, message string) {
+	g.failed = true
+	node, exists := g.tasks[task.ID]
+	if !exists {
+		return
+	}
+	delete(g.tasks, task.ID)
+	node.agent, node.leased, node.attempts, node.finished = task.Agent, task.LeasedAt, task.Attempts, time.Now()
+	node.err = message
+}
+
+// Cancel останавливает вычисление графа: новые задачи больше не создаются, а операции,
+// которые еще не посчитаны, в плане отмечаются отмененными. Задачи из очереди удаляет вызывающий
+func (g *Graph) Cancel() {
+	g.failed = true
+}
+
+func (g *Graph) Done() bool {
+	return g.Root.Done
+}
+
+func (g *Graph) Result() string {
+	return g.Root.Result
+}
+
+// Makespan возвращает, сколько времени заняло вычисление графа от Start до результата;
+// false — граф еще не посчитан
+func (g *Graph) Makespan() (time.Duration, bool) {
+	if !g.Root.Done || g.started.IsZero() {
+		return 0, false
+	}
+	return g.Root.finished.Sub(g.started), true
+}
+
+// PendingTasks возвращает id задач, результата которых ждет граф
+func (g *Graph) PendingTasks() []int {
+	ids := make([]int, 0, len(g.tasks))
+	for id := range g.tasks {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (g *Graph) activate(node *Node) error {
+	if node.active || node.Done {
+		return nil
+	}
+	node.active = true
+
+	switch node.Kind {
+	case NumberNode:
+		return g.finish(node, node.Value)
+	case VariableNode:
+		return fmt.Errorf("unbound variable: %v", node.Value)
+	}
+
+	if node.Kind == ConditionalNode {
+		return g.choose(node)
+	}
+
+	node.waiting = 0
+	for _, child := range node.Children {
+		if !child.Done {
+			node.waiting++
+		}
+	}
+	if node.waiting == 0 {
+		return g.dispatch(node)
+	}
+	for _, child := range node.Children {
+		if err := g.activate(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// choose вычисляет условный оператор: сначала только условие, затем только выбранную ветвь.
+// Узел ждет одного операнда и перепроверяется, когда посчитан любой из них
+func (g *Graph) choose(node *Node) error {
+	next := node.Children[0]
+	if next.Done {
+		next = node.Children[2]
+		if isTrue(node.Children[0].Result) {
+			next = node.Children[1]
+		}
+		if next.Done {
+			return g.finish(node, next.Result)
+		}
+	}
+	node.waiting = 1
+	return g.activate(next)
+}
+
+// dispatch вычисляет узел, все операнды которого известны
+func (g *Graph) dispatch(node *Node) error {
+	if node.Kind == ConditionalNode {
+		return g.choose(node)
+	}
+
+	args := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		args[i] = child.Result
+	}
+
+	if node.Kind == NegateNode {
+		// смена знака выполняется сразу, без создания задачи
+		return g.finish(node, negate(args[0]))
+	}
+	if node.Kind == UnitNode {
+		// перевод в основные единицы СИ тоже выполняется без задачи
+		value, err := convertUnit(g.Mode, args[0], node.Value)
+		if err != nil {
+			return err
+		}
+		return g.finish(node, value)
+	}
+	if result, cached := g.taskList.Cache.Get(g.cacheKey(node)); cached {
+		// такая же операция уже выполнялась, задача не нужна
+		node.cached = true
+		return g.finish(node, result)
+	}
+
+	owner := tasks.Owner{ExpressionID: g.ExpressionID, UserID: g.UserID, Priority: g.Priority, Rank: g.paths[node]}
+	switch node.Kind {
+	case OperatorNode:
+		node.TaskID = g.taskList.AddTask(*operatorTimes[node.Value], owner, g.Mode, node.Value, args[0], args[1])
+	case FunctionNode:
+		node.TaskID = g.taskList.AddFunctionTask(*functions[node.Value].time, owner, g.Mode, node.Value, args)
+	}
+	node.created = time.Now()
+	g.tasks[node.TaskID] = node
+	return nil
+}
+
+// cacheKey возвращает ключ операции узла в кэше результатов
+func (g *Graph) cacheKey(node *Node) string {
+	args := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		args[i] = child.Result
+	}
+	if node.Kind == FunctionNode {
+		return tasks.CacheKey(g.Mode, functionToken(node.Value, len(args)), args...)
+	}
+	return tasks.CacheKey(g.Mode, node.Value, args...)
+}
+
+func (g *Graph) finish(node *Node, result string) error {
+	node.Result = result
+	node.Done = true
+	node.finished = time.Now()
+	for _, parent := range node.Parents {
+		if !parent.active || parent.Done {
+			continue
+		}
+		parent.waiting--
+		if parent.waiting == 0 {
+			if err := g.dispatch(parent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package evaluation
+
+import (
+	"distributed_calculator/tasks"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTree(t *testing.T, expression string) *Node {
+	t.Helper()
+	postfix, err := InfixToPostfix(expression)
+	if err != nil {
+		t.Fatalf("InfixToPostfix(%q): %v", expression, err)
+	}
+	root, err := BuildTree(postfix)
+	if err != nil {
+		t.Fatalf("BuildTree(%q): %v", postfix, err)
+	}
+	return root
+}
+
+// calculate выполняет задачу вместо агента; поддерживает только операции из тестов
+func calculate(t *testing.T, task *tasks.Task) string {
+	t.Helper()
+	args := task.Args
+	if args == nil {
+		args = []string{task.Arg1, task.Arg2}
+	}
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		value, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			t.Fatalf("task %d: bad argument %q", task.ID, arg)
+		}
+		values[i] = value
+	}
+	switch task.Operator {
+	case "+":
+		return FormatNumber(values[0] + values[1])
+	case "*":
+		return FormatNumber(values[0] * values[1])
+	case "<":
+		if values[0] < values[1] {
+			return "1"
+		}
+		return "0"
+	case "max":
+		result := math.Inf(-1)
+		for _, value := range values {
+			result = math.Max(result, value)
+		}
+		return FormatNumber(result)
+	}
+	t.Fatalf("task %d: unsupported operation %v", task.ID, task.Operator)
+	return ""
+}
+
+// runGraph вычисляет граф, выполняя задачи по одной, и возвращает результат и выполненные операции
+func runGraph(t *testing.T, root *Node) (string, []string) {
+	t.Helper()
+	taskList := tasks.NewTasks()
+	taskList.Lease = time.Minute
+	taskList.MaxAttempts = 1
+	graph := NewGraph(1, tasks.FloatMode, root, taskList)
+	if err := graph.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	var operations []string
+	for !graph.Done() {
+		task, err := taskList.GetTask("agent")
+		if err != nil {
+			t.Fatalf("graph is not done, but there are no tasks: %v", err)
+		}
+		operations = append(operations, task.Operator)
+		if _, err := taskList.CompleteTask(task.ID, "agent"); err != nil {
+			t.Fatalf("CompleteTask(%d): %v", task.ID, err)
+		}
+		if err := graph.Complete(task, calculate(t, task)); err != nil {
+			t.Fatalf("Complete(%d): %v", task.ID, err)
+		}
+	}
+	if pending := graph.PendingTasks(); len(pending) != 0 {
+		t.Errorf("graph is done, but still waits for tasks %v", pending)
+	}
+	return graph.Result(), operations
+}
+
+func TestBuildTree(t *testing.T) {
+	tests := []struct {
+		postfix []string
+		err     string
+	}{
+		{[]string{"1", "2", "+"}, ""},
+		{[]string{"x", "[m]"}, ""},
+		{[]string{"1", "2", "3", "max:3"}, ""},
+		{[]string{"+"}, "not enough operands for +"},
+		{[]string{"1", "2"}, "expression must produce exactly one value, got 2"},
+		{[]string{"1", "2", "max:3"}, "not enough operands for max"},
+		{[]string{"1", "2", "+", "[m]"}, "unit m must follow a number or variable"},
+	}
+	for _, test := range tests {
+		root, err := BuildTree(test.postfix)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("BuildTree(%q): %v", test.postfix, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("BuildTree(%q): got error %v, want %q", test.postfix, err, test.err)
+		case err == nil && root.String() != strings.Join(test.postfix, " "):
+			t.Errorf("BuildTree(%q).String() = %q", test.postfix, root.String())
+		}
+	}
+}
+
+func TestGraph(t *testing.T) {
+	tests := []struct {
+		expression string
+		result     string
+		operations []string
+	}{
+		{"2 + 3 * 4", "14", []string{"*", "+"}},
+		{"-(2 + 3)", "-5", []string{"+"}},
+		{"max(1, 2 + 3, 4)", "5", []string{"+", "max"}},
+		{"5 km + 300 m", "5300", []string{"+"}},
+		{"7", "7", nil},
+		// вычисляется только выбранная ветвь условного оператора
+		{"1 < 2 ? 3 + 4 : 5 * 6", "7", []string{"<", "+"}},
+		{"2 < 1 ? 3 + 4 : 5 * 6", "30", []string{"<", "*"}},
+		{"0 ? 3 + 4 : 5", "5", nil},
+	}
+	for _, test := range tests {
+		result, operations := runGraph(t, parseTree(t, test.expression))
+		if result != test.result {
+			t.Errorf("%q = %v, want %v", test.expression, result, test.result)
+		}
+		if !slices.Equal(operations, test.operations) {
+			t.Errorf("%q: operations %q, want %q", test.expression, operations, test.operations)
+		}
+	}
+}
+
+func TestGraphUnboundVariable(t *testing.T) {
+	graph := NewGraph(1, tasks.FloatMode, parseTree(t, "x + 1"), tasks.NewTasks())
+	if err := graph.Start(); err == nil || err.Error() != "unbound variable: x" {
+		t.Errorf("Start: got error %v, want unbound variable", err)
+	}
+}
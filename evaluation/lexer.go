@@ -0,0 +1,249 @@
+package evaluation
+
+import (
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	numberToken     tokenKind = iota
+	operatorToken             // бинарный оператор
+	unaryMinusToken           // унарный минус перед скобкой или другим унарным минусом
+	leftParenToken
+	rightParenToken
+	identifierToken // имя функции
+	commaToken      // разделитель аргументов функции
+	colonToken      // разделитель ветвей условного оператора cond ? a : b
+	unitToken       // единица измерения после числа или переменной: 5 km
+)
+
+type token struct { // структура лексемы выражения
+	kind  tokenKind
+	value string
+	pos   int // смещение лексемы в исходной строке (в байтах)
+	end   int // смещение конца лексемы в исходной строке
+}
+
+const unaryMinus = "~" // обозначение унарного минуса в постфиксной записи
+
+var twoCharOperators = []string{"//", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||"}
+
+const xor = "xor" // исключающее ИЛИ записывается словом, так как ^ — возведение в степень
+
+// operatorAt возвращает бинарный оператор, который начинается в позиции pos,
+// или пустую строку. Двухсимвольные операторы проверяются раньше односимвольных
+func operatorAt(expression string, pos int) string {
+	for _, operator := range twoCharOperators {
+		if len(expression)-pos >= 2 && expression[pos:pos+2] == operator {
+			return operator
+		}
+	}
+	switch expression[pos] {
+	case '+', '-', '*', '/', '%', '^', '<', '>', '?', '&', '|':
+		return expression[pos : pos+1]
+	}
+	return ""
+}
+
+// isUnaryPosition сообщает, стоит ли следующая лексема на месте операнда,
+// то есть может ли минус в этой позиции быть унарным
+func isUnaryPosition(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	switch tokens[len(tokens)-1].kind {
+	case operatorToken, unaryMinusToken, leftParenToken, commaToken, colonToken:
+		return true
+	}
+	return false
+}
+
+func skipSpaces(expression string, pos int) int {
+	for pos < len(expression) {
+		r, size := utf8.DecodeRuneInString(expression[pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+func isDigit(expression string, pos int) bool {
+	return pos < len(expression) && expression[pos] >= '0' && expression[pos] <= '9'
+}
+
+// scanNumber возвращает конец числа, начинающегося в pos: целая часть
+// и необязательная дробная часть после точки (1, 1.5, .5)
+func scanNumber(expression string, pos int) int {
+	for isDigit(expression, pos) {
+		pos++
+	}
+	if pos < len(expression) && expression[pos] == '.' && isDigit(expression, pos+1) {
+		pos++
+		for isDigit(expression, pos) {
+			pos++
+		}
+	}
+	return pos
+}
+
+// basePrefixes — префиксы целых чисел в других системах счисления и их допустимые цифры
+var basePrefixes = map[byte]string{
+	'x': "0123456789abcdefABCDEF",
+	'b': "01",
+	'o': "01234567",
+}
+
+// scanBaseNumber возвращает конец целого числа с префиксом системы счисления
+// (0xFF, 0b1010, 0o17), начинающегося в pos, или pos, если такого числа там нет
+func scanBaseNumber(expression string, pos int) int {
+	if pos+2 >= len(expression) || expression[pos] != '0' {
+		return pos
+	}
+	digits, exists := basePrefixes[expression[pos+1]|0x20] // 0X и 0x равнозначны
+	if !exists {
+		return pos
+	}
+	end := pos + 2
+	for end < len(expression) && strings.IndexByte(digits, expression[end]) >= 0 {
+		end++
+	}
+	if end == pos+2 {
+		return pos
+	}
+	return end
+}
+
+// scanLiteral возвращает конец числа, начинающегося в pos, и его десятичную запись:
+// числа с префиксом системы счисления сразу переводятся в десятичные
+func scanLiteral(expression string, pos int) (int, string) {
+	if end := scanBaseNumber(expression, pos); end > pos {
+		value, _ := new(big.Int).SetString(expression[pos:end], 0)
+		return end, value.String()
+	}
+	end := scanNumber(expression, pos)
+	return end, expression[pos:end]
+}
+
+func isIdentifierChar(expression string, pos int, first bool) bool {
+	if pos >= len(expression) {
+		return false
+	}
+	c := expression[pos]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+func isNumberStart(expression string, pos int) bool {
+	return isDigit(expression, pos) || (pos < len(expression) && expression[pos] == '.' && isDigit(expression, pos+1))
+}
+
+// followedByPower сообщает, идет ли после позиции pos возведение в степень:
+// в -2^2 минус относится ко всей степени, поэтому число не склеивается с минусом
+func followedByPower(expression string, pos int) bool {
+	pos = skipSpaces(expression, pos)
+	return pos < len(expression) && expression[pos] == '^'
+}
+
+// scanUnitExponent возвращает конец целой степени единицы измерения (m^2, s^-1),
+// которая начинается в pos, или pos, если степени там нет. Степень относится
+// к единице, а не к числу: 5 m^2 — пять квадратных метров
+func scanUnitExponent(expression string, pos int) int {
+	next := skipSpaces(expression, pos)
+	if next >= len(expression) || expression[next] != '^' {
+		return pos
+	}
+	start := skipSpaces(expression, next+1)
+	if start < len(expression) && expression[start] == '-' {
+		start++
+	}
+	end := start
+	for isDigit(expression, end) {
+		end++
+	}
+	if end == start || (end < len(expression) && (expression[end] == '.' || isIdentifierChar(expression, end, false))) {
+		return pos // степень — не целое число, это возведение в степень всей величины
+	}
+	return end
+}
+
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+
+	pos := 0
+	for {
+		pos = skipSpaces(expression, pos)
+		if pos >= len(expression) {
+			break
+		}
+		r, size := utf8.DecodeRuneInString(expression[pos:])
+		if r == '−' { // типографский минус (U+2212) обрабатывается как обычный
+			r = '-'
+		}
+
+		switch {
+		case isNumberStart(expression, pos):
+			end, value := scanLiteral(expression, pos)
+			tokens = append(tokens, token{kind: numberToken, value: value, pos: pos, end: end})
+			pos = end
+		case r == '-' && isUnaryPosition(tokens):
+			next := skipSpaces(expression, pos+size)
+			if isNumberStart(expression, next) {
+				if end, value := scanLiteral(expression, next); !followedByPower(expression, end) {
+					// отрицательное число записывается одной лексемой
+					tokens = append(tokens, token{kind: numberToken, value: negate(value), pos: pos, end: end})
+					pos = end
+					continue
+				}
+			}
+			tokens = append(tokens, token{kind: unaryMinusToken, value: unaryMinus, pos: pos, end: pos + size})
+			pos += size
+		case r == '+' && isUnaryPosition(tokens):
+			pos += size // унарный плюс не меняет значение
+		case r == '-': // обычный или типографский минус, который занимает несколько байт
+			tokens = append(tokens, token{kind: operatorToken, value: "-", pos: pos, end: pos + size})
+			pos += size
+		case operatorAt(expression, pos) != "":
+			operator := operatorAt(expression, pos)
+			tokens = append(tokens, token{kind: operatorToken, value: operator, pos: pos, end: pos + len(operator)})
+			pos += len(operator)
+		case r == ':':
+			tokens = append(tokens, token{kind: colonToken, value: ":", pos: pos, end: pos + size})
+			pos += size
+		case isIdentifierChar(expression, pos, true):
+			end := pos + 1
+			for isIdentifierChar(expression, end, false) {
+				end++
+			}
+			if expression[pos:end] == xor {
+				tokens = append(tokens, token{kind: operatorToken, value: xor, pos: pos, end: end})
+			} else if len(tokens) > 0 && (tokens[len(tokens)-1].kind == numberToken || tokens[len(tokens)-1].kind == identifierToken) {
+				// имя сразу после числа или переменной — единица измерения, возможно, со степенью
+				end = scanUnitExponent(expression, end)
+				name := strings.Join(strings.Fields(expression[pos:end]), "")
+				tokens = append(tokens, token{kind: unitToken, value: name, pos: pos, end: end})
+			} else {
+				tokens = append(tokens, token{kind: identifierToken, value: expression[pos:end], pos: pos, end: end})
+			}
+			pos = end
+		case r == ',':
+			tokens = append(tokens, token{kind: commaToken, value: ",", pos: pos, end: pos + size})
+			pos += size
+		case r == '(':
+			tokens = append(tokens, token{kind: leftParenToken, value: "(", pos: pos, end: pos + size})
+			pos += size
+		case r == ')':
+			tokens = append(tokens, token{kind: rightParenToken, value: ")", pos: pos, end: pos + size})
+			pos += size
+		default:
+			return nil, newParseError(expression, pos, expression[pos:pos+size], "invalid token: "+expression[pos:pos+size],
+				"number, operator or parenthesis")
+		}
+	}
+
+	return tokens, nil
+}
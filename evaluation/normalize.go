@@ -0,0 +1,64 @@
+package evaluation
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+)
+
+var commutative = map[string]bool{ // операции, результат которых не зависит от порядка операндов
+	"+":   true,
+	"*":   true,
+	"==":  true,
+	"!=":  true,
+	"&&":  true,
+	"||":  true,
+	"&":   true,
+	"|":   true,
+	xor:   true,
+	"min": true,
+	"max": true,
+}
+
+// Normalize возвращает каноническую запись дерева выражения: пробелы в исходной строке
+// на нее не влияют, а операнды коммутативных операций упорядочены, поэтому
+// 2 + 3*x и x*3+2 дают одну и ту же запись
+func Normalize(root *Node) string {
+	normalized := make(map[*Node]string)
+
+	var normalize func(node *Node) string
+	normalize = func(node *Node) string {
+		if key, exists := normalized[node]; exists {
+			return key
+		}
+		if len(node.Children) == 0 {
+			return node.Value
+		}
+		operands := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			operands[i] = normalize(child)
+		}
+		if node.Kind == NegateNode && isNumberLiteral(operands[0]) {
+			// -(2) и -2 — одно и то же число
+			normalized[node] = negate(operands[0])
+			return normalized[node]
+		}
+		if (node.Kind == OperatorNode || node.Kind == FunctionNode) && commutative[node.Value] {
+			sort.Strings(operands)
+		}
+		name := node.Value
+		if node.Kind == UnitNode { // единица и функция с тем же именем — разные узлы
+			name = unitPostfix(name)
+		}
+		key := name + "(" + strings.Join(operands, ",") + ")"
+		normalized[node] = key
+		return key
+	}
+	return normalize(root)
+}
+
+// isNumberLiteral сообщает, является ли каноническая запись операнда числом
+func isNumberLiteral(key string) bool {
+	_, ok := new(big.Rat).SetString(key)
+	return ok && !strings.Contains(key, "/")
+}
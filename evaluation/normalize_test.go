@@ -0,0 +1,26 @@
+package evaluation
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"2 + 3*x", "x*3+2", true},
+		{"max(a, b, c)", "max(c, a, b)", true},
+		{"1 == x", "x == 1", true},
+		{"-(2) + 1", "1 + -2", true},
+		{"(1 + 2) + 3", "1 + (2 + 3)", false},
+		{"a - b", "b - a", false},
+		{"2 ^ 3", "3 ^ 2", false},
+		{"-(2 + 3)", "-2 + 3", false},
+		{"5 km", "5000 m", false},
+	}
+	for _, test := range tests {
+		a, b := Normalize(parseTree(t, test.a)), Normalize(parseTree(t, test.b))
+		if (a == b) != test.equal {
+			t.Errorf("Normalize(%q) = %q, Normalize(%q) = %q, want equal: %v", test.a, a, test.b, b, test.equal)
+		}
+	}
+}
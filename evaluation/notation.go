@@ -0,0 +1,160 @@
+package evaluation
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const ( // записи, в которых принимается выражение
+	InfixNotation   = "infix"   // обычная запись: 2 + 3 * 4
+	PostfixNotation = "postfix" // обратная польская запись: 2 3 4 * +
+	PrefixNotation  = "prefix"  // польская запись: + 2 * 3 4
+)
+
+const expectedPostfixToken = "number, variable, operator, ~, ?:, function:count or [unit]"
+
+// ParseExpression переводит выражение в записи notation в постфиксную запись.
+// Пустая запись означает infix. В postfix и prefix лексемы разделяются пробелами и
+// записываются так же, как в постфиксе оркестратора: ~ — смена знака, ?: — условный
+// оператор, min:3 — вызов функции с тремя аргументами, [km] — единица измерения
+// предыдущего числа
+func ParseExpression(expression, notation string) ([]string, error) {
+	switch notation {
+	case "", InfixNotation:
+		return InfixToPostfix(expression)
+	case PostfixNotation:
+		return parsePostfix(expression)
+	case PrefixNotation:
+		return parsePrefix(expression)
+	}
+	return nil, fmt.Errorf("unknown notation: %v", notation)
+}
+
+// splitWords разбивает выражение на лексемы, разделенные пробелами
+func splitWords(expression string) []token {
+	var words []token
+	pos := skipSpaces(expression, 0)
+	for pos < len(expression) {
+		end := pos
+		for end < len(expression) {
+			r, size := utf8.DecodeRuneInString(expression[end:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			end += size
+		}
+		words = append(words, token{value: expression[pos:end], pos: pos, end: end})
+		pos = skipSpaces(expression, end)
+	}
+	return words
+}
+
+// classifyWord проверяет лексему postfix или prefix записи и возвращает ее в виде,
+// принятом в постфиксе оркестратора, и число операндов, которые она забирает
+func classifyWord(expression string, word token) (string, int, error) {
+	value := strings.Replace(word.value, "−", "-", 1) // типографский минус (U+2212)
+
+	switch {
+	case value == unaryMinus:
+		return value, 1, nil
+	case value == conditional:
+		return value, 3, nil
+	case value != conditionalOpen && operatorTimes[value] != nil:
+		return value, 2, nil
+	case isVariable(value):
+		return value, 0, nil
+	case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+		if _, known := parseUnitToken(value); !known {
+			return "", 0, tokenError(expression, word, "unknown unit: "+value, "one of "+unitNames())
+		}
+		return value, 1, nil
+	}
+
+	if name, argsCount, isFunction := parseFunctionToken(value); isFunction {
+		if err := checkArity(name, argsCount); err != nil {
+			return "", 0, tokenError(expression, word, err.Error(), arityHint(name))
+		}
+		return functionToken(name, argsCount), argsCount, nil
+	}
+
+	number := strings.TrimPrefix(value, "-")
+	if isNumberStart(number, 0) {
+		if end, literal := scanLiteral(number, 0); end == len(number) {
+			if number != value {
+				literal = negate(literal)
+			}
+			return literal, 0, nil
+		}
+	}
+	return "", 0, tokenError(expression, word, "invalid token: "+word.value, expectedPostfixToken)
+}
+
+// parsePostfix проверяет постфиксную запись: каждой операции должно хватать операндов,
+// и в конце в стеке должно остаться ровно одно значение
+func parsePostfix(expression string) ([]string, error) {
+	words := splitWords(expression)
+	if len(words) == 0 {
+		return nil, newParseError(expression, len(expression), "", "empty expression", expectedPostfixToken)
+	}
+
+	postfix := make([]string, 0, len(words))
+	depth := 0 // число значений в стеке
+	for _, word := range words {
+		value, operands, err := classifyWord(expression, word)
+		if err != nil {
+			return nil, err
+		}
+		if depth < operands {
+			return nil, tokenError(expression, word, fmt.Sprintf("not enough operands for %v", word.value),
+				fmt.Sprintf("%d operand(s) before it", operands))
+		}
+		depth += 1 - operands
+		postfix = append(postfix, value)
+	}
+	if depth > 1 {
+		return nil, newParseError(expression, len(expression), "",
+			fmt.Sprintf("%d values left without an operator", depth), "operator")
+	}
+	return postfix, nil
+}
+
+// parsePrefix переводит префиксную запись в постфиксную: операция записывается
+// после всех своих операндов
+func parsePrefix(expression string) ([]string, error) {
+	words := splitWords(expression)
+	if len(words) == 0 {
+		return nil, newParseError(expression, len(expression), "", "empty expression", expectedPostfixToken)
+	}
+
+	postfix := make([]string, 0, len(words))
+	next := 0
+	var parse func() error
+	parse = func() error {
+		if next >= len(words) {
+			return newParseError(expression, len(expression), "", "unexpected end of expression", "operand")
+		}
+		word := words[next]
+		next++
+		value, operands, err := classifyWord(expression, word)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < operands; i++ {
+			if err := parse(); err != nil {
+				return err
+			}
+		}
+		postfix = append(postfix, value)
+		return nil
+	}
+
+	if err := parse(); err != nil {
+		return nil, err
+	}
+	if next < len(words) {
+		return nil, tokenError(expression, words[next], "unexpected token: "+words[next].value, "end of expression")
+	}
+	return postfix, nil
+}
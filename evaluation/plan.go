@@ -0,0 +1,147 @@
+package evaluation
+
+import (
+	"strconv"
+	"time"
+)
+
+const ( // состояния шага плана
+	StepWaiting   = "waiting"   // ждет операндов
+	StepPending   = "pending"   // задача в очереди, агент ее еще не взял
+	StepLeased    = "leased"    // задачу выполняет агент
+	StepDone      = "done"      // значение известно
+	StepFailed    = "failed"    // агент вернул ошибку или не успел выполнить задачу
+	StepCancelled = "cancelled" // вычисление остановлено раньше, чем посчитана операция
+	StepSkipped   = "skipped"   // значение не понадобилось (невыбранная ветвь условного оператора)
+)
+
+var nodeKinds = map[NodeKind]string{
+	OperatorNode:    "operator",
+	FunctionNode:    "function",
+	NegateNode:      "negate",
+	ConditionalNode: "conditional",
+	UnitNode:        "unit",
+}
+
+type PlanStep struct { // операция выражения и задача, которая ее вычисляет
+	ID         int        `json:"id"`
+	Kind       string     `json:"kind"`      // operator, function, negate, conditional или unit
+	Operation  string     `json:"operation"` // оператор, имя функции или единица измерения
+	Operands   []string   `json:"operands"`  // числа, переменные или ссылки на шаги вида #2
+	DependsOn  []int      `json:"depends_on,omitempty"`
+	Local      bool       `json:"local,omitempty"` // вычисляется оркестратором без задачи
+	State      string     `json:"state"`
+	TaskID     int        `json:"task_id,omitempty"`
+	Agent      string     `json:"agent,omitempty"`
+	Attempts   int        `json:"attempts,omitempty"` // сколько раз задача выдавалась агентам
+	Cached     bool       `json:"cached,omitempty"`   // результат взят из кэша операций
+	Result     string     `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	LeasedAt   *time.Time `json:"leased_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	QueueMs    *int64     `json:"queue_ms,omitempty"` // сколько задача ждала агента
+	RunMs      *int64     `json:"run_ms,omitempty"`   // сколько агент выполнял задачу
+}
+
+type Plan struct { // граф задач выражения
+	Root  int        `json:"root"`  // шаг, дающий результат; 0 — выражение не требует операций
+	Tasks int        `json:"tasks"` // сколько задач нужно для вычисления
+	Steps []PlanStep `json:"steps"` // операнды идут раньше использующих их шагов
+}
+
+// PlanTree возвращает план вычисления дерева, которое еще не запускалось
+func PlanTree(root *Node) Plan {
+	return buildPlan(root, func(node *Node) PlanStep {
+		return PlanStep{State: StepWaiting}
+	})
+}
+
+// Plan возвращает план вычисления с текущим состоянием каждой операции
+func (g *Graph) Plan() Plan {
+	stopped := g.failed || g.Root.Done
+	return buildPlan(g.Root, func(node *Node) PlanStep {
+		step := PlanStep{TaskID: node.TaskID, Agent: node.agent, Attempts: node.attempts, Cached: node.cached,
+			Result: node.Result, Error: node.err}
+		leased := node.leased
+		switch {
+		case node.Done:
+			step.State = StepDone
+		case node.err != "":
+			step.State = StepFailed
+		case node.TaskID != 0:
+			task, queued := g.taskList.Lookup(node.TaskID)
+			step.Attempts = task.Attempts
+			switch {
+			case !queued:
+				step.State = StepCancelled
+			case task.LeasedAt.IsZero():
+				step.State = StepPending
+			default:
+				step.State = StepLeased
+				step.Agent, leased = task.Agent, task.LeasedAt
+			}
+		case !stopped:
+			step.State = StepWaiting
+		case node.active:
+			step.State = StepCancelled
+		default:
+			step.State = StepSkipped
+		}
+
+		step.CreatedAt = timestamp(node.created)
+		step.LeasedAt = timestamp(leased)
+		step.FinishedAt = timestamp(node.finished)
+		step.QueueMs = elapsed(node.created, leased)
+		step.RunMs = elapsed(leased, node.finished)
+		return step
+	})
+}
+
+// buildPlan нумерует операции дерева так, что операнды идут раньше использующих их
+// операций, и заполняет состояние каждой операции функцией describe
+func buildPlan(root *Node, describe func(node *Node) PlanStep) Plan {
+	plan := Plan{Steps: []PlanStep{}}
+	ids := make(map[*Node]int)
+	walk(root, func(node *Node) {
+		kind, isOperation := nodeKinds[node.Kind]
+		if !isOperation {
+			return
+		}
+		step := describe(node)
+		step.ID = len(plan.Steps) + 1
+		step.Kind = kind
+		step.Operation = node.Value
+		step.Local = node.Kind == NegateNode || node.Kind == ConditionalNode || node.Kind == UnitNode
+		if !step.Local {
+			plan.Tasks++
+		}
+		for _, child := range node.Children {
+			if id, isStep := ids[child]; isStep {
+				step.Operands = append(step.Operands, "#"+strconv.Itoa(id))
+				step.DependsOn = append(step.DependsOn, id)
+			} else {
+				step.Operands = append(step.Operands, child.Value)
+			}
+		}
+		ids[node] = step.ID
+		plan.Steps = append(plan.Steps, step)
+	})
+	plan.Root = ids[root]
+	return plan
+}
+
+func timestamp(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func elapsed(from, to time.Time) *int64 {
+	if from.IsZero() || to.IsZero() {
+		return nil
+	}
+	ms := to.Sub(from).Milliseconds()
+	return &ms
+}
@@ -0,0 +1,366 @@
+package evaluation
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// nodePrecedence возвращает приоритет, с которым узел записывается в инфиксной форме;
+// отрицательное число записывается как унарный минус. Для чисел, переменных
+// и функций скобки не нужны, и второе значение — false
+func nodePrecedence(node *Node) (int, bool) {
+	switch node.Kind {
+	case UnitNode: // единица относится к числу, и скобки нужны там же, где и числу
+		return nodePrecedence(node.Children[0])
+	case OperatorNode, ConditionalNode:
+		return precedence[node.Value], true
+	case NegateNode:
+		return precedence[unaryMinus], true
+	case NumberNode:
+		if strings.HasPrefix(node.Value, "-") {
+			return precedence[unaryMinus], true
+		}
+	}
+	return 0, false
+}
+
+// needsParens сообщает, нужно ли взять в скобки операнд index узла parent,
+// чтобы запись разбиралась в то же дерево
+func needsParens(parent *Node, index int) bool {
+	if child := parent.Children[index]; parent.Kind == NegateNode &&
+		(child.Kind == NumberNode || (child.Kind == UnitNode && child.Children[0].Kind == NumberNode)) {
+		return true // -2 разбирается как отрицательное число, а не как смена знака числа 2
+	}
+	if parent.Kind == OperatorNode && parent.Value == "^" && index == 0 && parent.Children[0].Kind == UnitNode {
+		return true // 5 m^2 — это 5 квадратных метров, а не (5 m)^2
+	}
+	childPrecedence, ok := nodePrecedence(parent.Children[index])
+	if !ok {
+		return false
+	}
+	switch parent.Kind {
+	case NegateNode:
+		return childPrecedence <= precedence[unaryMinus]
+	case ConditionalNode:
+		return index == 0 && childPrecedence == precedence[conditional]
+	case OperatorNode:
+		parentPrecedence := precedence[parent.Value]
+		if childPrecedence != parentPrecedence {
+			return childPrecedence < parentPrecedence
+		}
+		if associativity[parent.Value] == "L" {
+			return index > 0
+		}
+		return index == 0
+	}
+	return false
+}
+
+// Infix записывает дерево в канонической инфиксной форме с минимумом скобок:
+// результат разбирается InfixToPostfix в то же дерево
+func Infix(root *Node) string {
+	var sb strings.Builder
+	var write func(node *Node)
+	operand := func(node *Node, index int) {
+		if needsParens(node, index) {
+			sb.WriteString("(")
+			write(node.Children[index])
+			sb.WriteString(")")
+		} else {
+			write(node.Children[index])
+		}
+	}
+	write = func(node *Node) {
+		switch node.Kind {
+		case NumberNode, VariableNode:
+			sb.WriteString(node.Value)
+		case UnitNode:
+			write(node.Children[0])
+			sb.WriteString(" " + node.Value)
+		case NegateNode:
+			sb.WriteString("-")
+			operand(node, 0)
+		case OperatorNode:
+			operand(node, 0)
+			if node.Value == "^" {
+				sb.WriteString("^")
+			} else {
+				sb.WriteString(" " + node.Value + " ")
+			}
+			operand(node, 1)
+		case ConditionalNode:
+			operand(node, 0)
+			sb.WriteString(" ? ")
+			operand(node, 1)
+			sb.WriteString(" : ")
+			operand(node, 2)
+		case FunctionNode:
+			sb.WriteString(node.Value + "(")
+			for i := range node.Children {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				operand(node, i)
+			}
+			sb.WriteString(")")
+		}
+	}
+	write(root)
+	return sb.String()
+}
+
+var latexOperators = map[string]string{
+	"+":   "+",
+	"-":   "-",
+	"*":   `\cdot`,
+	"%":   `\bmod`,
+	"<":   "<",
+	"<=":  `\le`,
+	">":   ">",
+	">=":  `\ge`,
+	"==":  "=",
+	"!=":  `\ne`,
+	"&&":  `\land`,
+	"||":  `\lor`,
+	"&":   `\mathbin{\&}`,
+	"|":   `\mathbin{|}`,
+	xor:   `\oplus`,
+	"<<":  `\ll`,
+	">>":  `\gg`,
+	"min": `\min`,
+	"max": `\max`,
+}
+
+// LaTeX записывает дерево в виде формулы LaTeX: деление — дробью, степень — индексом,
+// условный оператор — системой cases
+func LaTeX(root *Node) string {
+	var sb strings.Builder
+	var write func(node *Node)
+	operand := func(node *Node, index int) {
+		if needsParens(node, index) {
+			sb.WriteString(`\left(`)
+			write(node.Children[index])
+			sb.WriteString(`\right)`)
+		} else {
+			write(node.Children[index])
+		}
+	}
+	group := func(node *Node) { // операнд внутри фигурных скобок LaTeX не нуждается в круглых
+		sb.WriteString("{")
+		write(node)
+		sb.WriteString("}")
+	}
+	write = func(node *Node) {
+		switch node.Kind {
+		case NumberNode:
+			sb.WriteString(node.Value)
+		case VariableNode:
+			if len(node.Value) > 1 {
+				sb.WriteString(`\mathit{` + strings.ReplaceAll(node.Value, "_", `\_`) + "}")
+			} else {
+				sb.WriteString(node.Value)
+			}
+		case UnitNode:
+			write(node.Children[0])
+			base, power := splitUnit(node.Value)
+			sb.WriteString(`\,\mathrm{` + base + "}")
+			if power != 1 {
+				sb.WriteString("^{" + strconv.Itoa(power) + "}")
+			}
+		case NegateNode:
+			sb.WriteString("-")
+			operand(node, 0)
+		case OperatorNode:
+			switch node.Value {
+			case "/":
+				sb.WriteString(`\frac`)
+				group(node.Children[0])
+				group(node.Children[1])
+			case "//":
+				sb.WriteString(`\left\lfloor \frac`)
+				group(node.Children[0])
+				group(node.Children[1])
+				sb.WriteString(` \right\rfloor`)
+			case "^":
+				sb.WriteString("{")
+				operand(node, 0)
+				sb.WriteString("}^")
+				group(node.Children[1])
+			default:
+				operand(node, 0)
+				sb.WriteString(" " + latexOperators[node.Value] + " ")
+				operand(node, 1)
+			}
+		case ConditionalNode:
+			sb.WriteString(`\begin{cases} `)
+			write(node.Children[1])
+			sb.WriteString(` & \text{if } `)
+			write(node.Children[0])
+			sb.WriteString(` \\ `)
+			write(node.Children[2])
+			sb.WriteString(` & \text{otherwise} \end{cases}`)
+		case FunctionNode:
+			switch node.Value {
+			case "sqrt":
+				sb.WriteString(`\sqrt`)
+				group(node.Children[0])
+			case "abs":
+				sb.WriteString(`\left|`)
+				write(node.Children[0])
+				sb.WriteString(`\right|`)
+			case "pow":
+				sb.WriteString("{")
+				if _, ok := nodePrecedence(node.Children[0]); ok {
+					sb.WriteString(`\left(`)
+					write(node.Children[0])
+					sb.WriteString(`\right)`)
+				} else {
+					write(node.Children[0])
+				}
+				sb.WriteString("}^")
+				group(node.Children[1])
+			default:
+				sb.WriteString(latexOperators[node.Value] + `\left(`)
+				for i, child := range node.Children {
+					if i > 0 {
+						sb.WriteString(", ")
+					}
+					write(child)
+				}
+				sb.WriteString(`\right)`)
+			}
+		}
+	}
+	write(root)
+	return sb.String()
+}
+
+var mathMLOperators = map[string]string{
+	"*":  "&#x22C5;",
+	"%":  "mod",
+	"<=": "&#x2264;",
+	">=": "&#x2265;",
+	"==": "=",
+	"!=": "&#x2260;",
+	"&&": "&#x2227;",
+	"||": "&#x2228;",
+	xor:  "&#x2295;",
+	"<<": "&#x226A;",
+	">>": "&#x226B;",
+}
+
+// MathML записывает дерево в виде документа MathML
+func MathML(root *Node) string {
+	var sb strings.Builder
+	var write func(node *Node)
+	mo := func(operator string) {
+		if entity, exists := mathMLOperators[operator]; exists {
+			operator = entity
+		} else {
+			operator = html.EscapeString(operator)
+		}
+		sb.WriteString("<mo>" + operator + "</mo>")
+	}
+	operand := func(node *Node, index int) {
+		if needsParens(node, index) {
+			sb.WriteString("<mrow><mo>(</mo>")
+			write(node.Children[index])
+			sb.WriteString("<mo>)</mo></mrow>")
+		} else {
+			write(node.Children[index])
+		}
+	}
+	row := func(node *Node) {
+		sb.WriteString("<mrow>")
+		write(node)
+		sb.WriteString("</mrow>")
+	}
+	write = func(node *Node) {
+		switch node.Kind {
+		case NumberNode:
+			if strings.HasPrefix(node.Value, "-") {
+				sb.WriteString("<mrow><mo>-</mo><mn>" + node.Value[1:] + "</mn></mrow>")
+			} else {
+				sb.WriteString("<mn>" + node.Value + "</mn>")
+			}
+		case VariableNode:
+			sb.WriteString("<mi>" + node.Value + "</mi>")
+		case UnitNode:
+			sb.WriteString("<mrow>")
+			write(node.Children[0])
+			sb.WriteString(`<mspace width="0.167em"/>`)
+			base, power := splitUnit(node.Value)
+			if power != 1 {
+				exponent := "<mn>" + strconv.Itoa(power) + "</mn>"
+				if power < 0 {
+					exponent = "<mrow><mo>-</mo><mn>" + strconv.Itoa(-power) + "</mn></mrow>"
+				}
+				sb.WriteString(`<msup><mi mathvariant="normal">` + base + "</mi>" + exponent + "</msup></mrow>")
+			} else {
+				sb.WriteString(`<mi mathvariant="normal">` + base + "</mi></mrow>")
+			}
+		case NegateNode:
+			sb.WriteString("<mrow><mo>-</mo>")
+			operand(node, 0)
+			sb.WriteString("</mrow>")
+		case OperatorNode:
+			switch node.Value {
+			case "/":
+				sb.WriteString("<mfrac>")
+				row(node.Children[0])
+				row(node.Children[1])
+				sb.WriteString("</mfrac>")
+			case "//":
+				sb.WriteString("<mrow><mo>&#x230A;</mo><mfrac>")
+				row(node.Children[0])
+				row(node.Children[1])
+				sb.WriteString("</mfrac><mo>&#x230B;</mo></mrow>")
+			case "^":
+				sb.WriteString("<msup><mrow>")
+				operand(node, 0)
+				sb.WriteString("</mrow>")
+				row(node.Children[1])
+				sb.WriteString("</msup>")
+			default:
+				sb.WriteString("<mrow>")
+				operand(node, 0)
+				mo(node.Value)
+				operand(node, 1)
+				sb.WriteString("</mrow>")
+			}
+		case ConditionalNode:
+			sb.WriteString("<mrow><mo>{</mo><mtable><mtr><mtd>")
+			write(node.Children[1])
+			sb.WriteString("</mtd><mtd><mtext>if&#xA0;</mtext>")
+			write(node.Children[0])
+			sb.WriteString("</mtd></mtr><mtr><mtd>")
+			write(node.Children[2])
+			sb.WriteString("</mtd><mtd><mtext>otherwise</mtext></mtd></mtr></mtable></mrow>")
+		case FunctionNode:
+			switch node.Value {
+			case "sqrt":
+				sb.WriteString("<msqrt>")
+				write(node.Children[0])
+				sb.WriteString("</msqrt>")
+			case "abs":
+				sb.WriteString("<mrow><mo>|</mo>")
+				write(node.Children[0])
+				sb.WriteString("<mo>|</mo></mrow>")
+			default:
+				sb.WriteString("<mrow><mi>" + node.Value + "</mi><mo>(</mo>")
+				for i, child := range node.Children {
+					if i > 0 {
+						sb.WriteString("<mo>,</mo>")
+					}
+					write(child)
+				}
+				sb.WriteString("<mo>)</mo></mrow>")
+			}
+		}
+	}
+	sb.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML">`)
+	row(root)
+	sb.WriteString("</math>")
+	return sb.String()
+}
@@ -0,0 +1,39 @@
+package evaluation
+
+import "testing"
+
+func TestInfix(t *testing.T) {
+	tests := []struct {
+		expression string
+		infix      string
+	}{
+		{"2+3*4", "2 + 3 * 4"},
+		{"(2+3)*4", "(2 + 3) * 4"},
+		{"2-(3-4)", "2 - (3 - 4)"},
+		{"(2^3)^2", "(2^3)^2"},
+		{"2^3^2", "2^3^2"},
+		{"-2^2", "-2^2"},
+		{"(-2)^2", "(-2)^2"},
+		{"-(2)", "-(2)"},
+		{"-(-2)", "-(-2)"},
+		{"1 - -2", "1 - -2"},
+		{"max(1,2+3)", "max(1, 2 + 3)"},
+		{"a?b:c?d:e", "a ? b : c ? d : e"},
+		{"(a?b:c)?d:e", "(a ? b : c) ? d : e"},
+		{"5 m^2", "5 m^2"},
+		{"(5 m)^2", "(5 m)^2"},
+		{"-(5 km)", "-(5 km)"},
+	}
+	for _, test := range tests {
+		root := parseTree(t, test.expression)
+		infix := Infix(root)
+		if infix != test.infix {
+			t.Errorf("Infix(%q) = %q, want %q", test.expression, infix, test.infix)
+			continue
+		}
+		// запись разбирается обратно в то же дерево
+		if reparsed := parseTree(t, infix); reparsed.String() != root.String() {
+			t.Errorf("Infix(%q) = %q parses as %q, want %q", test.expression, infix, reparsed, root)
+		}
+	}
+}
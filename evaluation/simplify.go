@@ -0,0 +1,165 @@
+package evaluation
+
+import "math/big"
+
+// Simplify упрощает дерево выражения до создания задач и возвращает новое дерево
+// и число сэкономленных задач. Оркестратор сам не выполняет арифметику, поэтому
+// упрощаются только тождества, результат которых известен без вычислений:
+// x+0, x-0, 0-x, x*1, x*0, x*-1, x/1, x^1, x^0, 1^x, смена знака числа, --x,
+// min и max от одного аргумента, abs(abs(x)), abs(-x) и условный оператор с числом
+// в условии.
+// Поддерево, умножаемое на 0, не вычисляется, поэтому ошибки в нем (например,
+// деление на ноль) не обнаруживаются
+func Simplify(root *Node) (*Node, int) {
+	before := CountTasks(root)
+	simplified := simplify(root)
+	linkParents(simplified)
+	return simplified, before - CountTasks(simplified)
+}
+
+// CountTasks возвращает число задач, которые нужно выполнить для вычисления дерева
+func CountTasks(root *Node) int {
+	count := 0
+	walk(root, func(node *Node) {
+		if node.Kind == OperatorNode || node.Kind == FunctionNode {
+			count++
+		}
+	})
+	return count
+}
+
+// walk обходит каждый узел графа один раз, операнды — раньше использующих их узлов
+func walk(root *Node, visit func(node *Node)) {
+	visited := make(map[*Node]bool)
+	var walkNode func(node *Node)
+	walkNode = func(node *Node) {
+		if visited[node] {
+			return
+		}
+		visited[node] = true
+		for _, child := range node.Children {
+			walkNode(child)
+		}
+		visit(node)
+	}
+	walkNode(root)
+}
+
+// linkParents заново заполняет Parents всех узлов по их Children
+func linkParents(root *Node) {
+	walk(root, func(node *Node) {
+		node.Parents = nil
+	})
+	walk(root, func(node *Node) {
+		for _, child := range node.Children {
+			child.Parents = append(child.Parents, node)
+		}
+	})
+}
+
+// isConstant сообщает, является ли узел числом, равным value
+func isConstant(node *Node, value int64) bool {
+	if node.Kind != NumberNode {
+		return false
+	}
+	number, ok := new(big.Rat).SetString(node.Value)
+	return ok && number.Cmp(new(big.Rat).SetInt64(value)) == 0
+}
+
+func negated(node *Node) *Node {
+	switch node.Kind {
+	case NumberNode:
+		return &Node{Kind: NumberNode, Value: negate(node.Value)}
+	case NegateNode:
+		return node.Children[0]
+	}
+	return &Node{Kind: NegateNode, Value: unaryMinus, Children: []*Node{node}}
+}
+
+func simplify(node *Node) *Node {
+	if len(node.Children) == 0 {
+		return &Node{Kind: node.Kind, Value: node.Value}
+	}
+	children := make([]*Node, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = simplify(child)
+	}
+	simplified := &Node{Kind: node.Kind, Value: node.Value, Children: children}
+
+	switch node.Kind {
+	case NegateNode:
+		return negated(children[0])
+	case OperatorNode:
+		a, b := children[0], children[1]
+		switch node.Value {
+		case "+":
+			if isConstant(b, 0) {
+				return a
+			}
+			if isConstant(a, 0) {
+				return b
+			}
+		case "-":
+			if isConstant(b, 0) {
+				return a
+			}
+			if isConstant(a, 0) {
+				return negated(b)
+			}
+		case "*":
+			if isConstant(a, 0) || isConstant(b, 0) {
+				return &Node{Kind: NumberNode, Value: "0"}
+			}
+			if isConstant(b, 1) {
+				return a
+			}
+			if isConstant(a, 1) {
+				return b
+			}
+			if isConstant(b, -1) {
+				return negated(a)
+			}
+			if isConstant(a, -1) {
+				return negated(b)
+			}
+		case "/":
+			if isConstant(b, 1) {
+				return a
+			}
+			if isConstant(b, -1) {
+				return negated(a)
+			}
+		case "^":
+			if isConstant(b, 1) {
+				return a
+			}
+			if isConstant(b, 0) || isConstant(a, 1) {
+				return &Node{Kind: NumberNode, Value: "1"}
+			}
+		}
+	case ConditionalNode:
+		if children[0].Kind == NumberNode {
+			if isTrue(children[0].Value) {
+				return children[1]
+			}
+			return children[2]
+		}
+	case FunctionNode:
+		switch node.Value {
+		case "min", "max":
+			if len(children) == 1 {
+				return children[0]
+			}
+		case "abs":
+			arg := children[0]
+			if arg.Kind == NegateNode {
+				arg = arg.Children[0]
+				simplified.Children[0] = arg
+			}
+			if arg.Kind == FunctionNode && arg.Value == "abs" {
+				return arg
+			}
+		}
+	}
+	return simplified
+}
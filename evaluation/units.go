@@ -0,0 +1,321 @@
+package evaluation
+
+import (
+	"distributed_calculator/tasks"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const baseDimensions = 6
+
+type dimension [baseDimensions]int // степени основных единиц СИ
+
+var baseUnits = [baseDimensions]string{"m", "kg", "s", "A", "K", "mol"}
+
+type unit struct { // единица измерения
+	dim   dimension
+	scale string // сколько основных единиц СИ в одной единице (точная дробь)
+}
+
+var (
+	length      = dimension{1, 0, 0, 0, 0, 0}
+	mass        = dimension{0, 1, 0, 0, 0, 0}
+	duration    = dimension{0, 0, 1, 0, 0, 0}
+	current     = dimension{0, 0, 0, 1, 0, 0}
+	temperature = dimension{0, 0, 0, 0, 1, 0}
+	amount      = dimension{0, 0, 0, 0, 0, 1}
+	volume      = dimension{3, 0, 0, 0, 0, 0}
+	frequency   = dimension{0, 0, -1, 0, 0, 0}
+	force       = dimension{1, 1, -2, 0, 0, 0}
+	pressure    = dimension{-1, 1, -2, 0, 0, 0}
+	energy      = dimension{2, 1, -2, 0, 0, 0}
+	power       = dimension{2, 1, -3, 0, 0, 0}
+	voltage     = dimension{2, 1, -3, -1, 0, 0}
+)
+
+var units = map[string]unit{
+	"m":      {length, "1"},
+	"km":     {length, "1000"},
+	"cm":     {length, "1/100"},
+	"mm":     {length, "1/1000"},
+	"mi":     {length, "1609.344"},
+	"ft":     {length, "0.3048"},
+	"in":     {length, "0.0254"},
+	"kg":     {mass, "1"},
+	"g":      {mass, "1/1000"},
+	"mg":     {mass, "1/1000000"},
+	"s":      {duration, "1"},
+	"ms":     {duration, "1/1000"},
+	"minute": {duration, "60"}, // не min: так называется функция
+	"h":      {duration, "3600"},
+	"A":      {current, "1"},
+	"mA":     {current, "1/1000"},
+	"K":      {temperature, "1"},
+	"mol":    {amount, "1"},
+	"L":      {volume, "1/1000"},
+	"mL":     {volume, "1/1000000"},
+	"Hz":     {frequency, "1"},
+	"N":      {force, "1"},
+	"kN":     {force, "1000"},
+	"Pa":     {pressure, "1"},
+	"kPa":    {pressure, "1000"},
+	"J":      {energy, "1"},
+	"kJ":     {energy, "1000"},
+	"W":      {power, "1"},
+	"kW":     {power, "1000"},
+	"V":      {voltage, "1"},
+}
+
+var derivedUnits = []string{"N", "Pa", "J", "W", "V", "Hz"} // имена производных единиц СИ для результата
+
+// unitPostfix записывает единицу измерения в постфиксе: 5 km — это 5 [km]
+func unitPostfix(name string) string {
+	return "[" + name + "]"
+}
+
+func parseUnitToken(token string) (string, bool) {
+	if len(token) < 3 || token[0] != '[' || token[len(token)-1] != ']' {
+		return "", false
+	}
+	name := token[1 : len(token)-1]
+	_, known := lookupUnit(name)
+	return name, known
+}
+
+const maxUnitExponent = 9 // наибольшая степень единицы: m^3, s^-2
+
+// splitUnit разделяет имя единицы на основную единицу и ее степень: m^2 — это m и 2.
+// Степень 0 означает, что записана она неверно
+func splitUnit(name string) (string, int) {
+	base, exponent, found := strings.Cut(name, "^")
+	if !found {
+		return name, 1
+	}
+	power, err := strconv.Atoi(exponent)
+	if err != nil || power < -maxUnitExponent || power > maxUnitExponent {
+		return base, 0
+	}
+	return base, power
+}
+
+// lookupUnit возвращает единицу измерения по имени, которое может содержать целую
+// степень: km^2 — это квадратный километр, а не километр, возведенный в квадрат вместе с числом
+func lookupUnit(name string) (unit, bool) {
+	base, power := splitUnit(name)
+	u, known := units[base]
+	if !known || power == 0 {
+		return unit{}, false
+	}
+	if power == 1 {
+		return u, true
+	}
+	scale, _ := new(big.Rat).SetString(u.scale)
+	powered := big.NewRat(1, 1)
+	for i := 0; i < power || i < -power; i++ {
+		powered.Mul(powered, scale)
+	}
+	if power < 0 {
+		powered.Inv(powered)
+	}
+	return unit{dim: dimension{}.add(u.dim, power), scale: powered.RatString()}, true
+}
+
+func unitNames() string {
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (d dimension) String() string {
+	if d == (dimension{}) {
+		return "dimensionless"
+	}
+	for _, name := range derivedUnits {
+		if units[name].dim == d {
+			return name
+		}
+	}
+	var numerator, denominator []string
+	for i, exponent := range d {
+		switch {
+		case exponent == 1:
+			numerator = append(numerator, baseUnits[i])
+		case exponent > 1:
+			numerator = append(numerator, baseUnits[i]+"^"+strconv.Itoa(exponent))
+		case exponent == -1:
+			denominator = append(denominator, baseUnits[i])
+		case exponent < -1:
+			denominator = append(denominator, baseUnits[i]+"^"+strconv.Itoa(-exponent))
+		}
+	}
+	result := strings.Join(numerator, "*")
+	if result == "" {
+		result = "1"
+	}
+	switch len(denominator) {
+	case 0:
+	case 1:
+		result += "/" + denominator[0]
+	default:
+		result += "/(" + strings.Join(denominator, "*") + ")"
+	}
+	return result
+}
+
+func (d dimension) add(other dimension, times int) dimension {
+	for i := range d {
+		d[i] += other[i] * times
+	}
+	return d
+}
+
+// integerConstant возвращает значение узла, если это целое число (возможно, со сменой знака)
+func integerConstant(node *Node) (int, bool) {
+	sign := 1
+	if node.Kind == NegateNode {
+		sign, node = -1, node.Children[0]
+	}
+	if node.Kind != NumberNode {
+		return 0, false
+	}
+	value, err := strconv.Atoi(node.Value)
+	return sign * value, err == nil
+}
+
+// CheckUnits проверяет размерности выражения и возвращает единицу результата в основных
+// единицах СИ (например, m/s или N); у безразмерного результата единица пустая.
+// Складывать, вычитать и сравнивать можно только величины одной размерности
+func CheckUnits(root *Node) (string, error) {
+	dims := make(map[*Node]dimension)
+	var check func(node *Node) (dimension, error)
+	check = func(node *Node) (dimension, error) {
+		if d, known := dims[node]; known {
+			return d, nil
+		}
+		operands := make([]dimension, len(node.Children))
+		for i, child := range node.Children {
+			d, err := check(child)
+			if err != nil {
+				return dimension{}, err
+			}
+			operands[i] = d
+		}
+		same := func(action string) error {
+			for _, d := range operands[1:] {
+				if d != operands[0] {
+					return fmt.Errorf("incompatible units: cannot %v %v and %v", action, operands[0], d)
+				}
+			}
+			return nil
+		}
+		power := func(base, exponent *Node) (dimension, error) {
+			if operands[1] != (dimension{}) {
+				return dimension{}, fmt.Errorf("exponent must be dimensionless, got %v", operands[1])
+			}
+			if operands[0] == (dimension{}) {
+				return dimension{}, nil
+			}
+			times, ok := integerConstant(exponent)
+			if !ok {
+				return dimension{}, fmt.Errorf("a quantity in %v can only be raised to an integer constant", operands[0])
+			}
+			return dimension{}.add(operands[0], times), nil
+		}
+
+		var result dimension
+		var err error
+		switch node.Kind {
+		case UnitNode:
+			u, _ := lookupUnit(node.Value)
+			result = operands[0].add(u.dim, 1)
+		case NegateNode:
+			result = operands[0]
+		case ConditionalNode:
+			operands = operands[1:]
+			err = same("choose between")
+			result = operands[0]
+		case FunctionNode:
+			switch node.Value {
+			case "sqrt":
+				for i, exponent := range operands[0] {
+					if exponent%2 != 0 {
+						return dimension{}, fmt.Errorf("cannot take the square root of %v", operands[0])
+					}
+					result[i] = exponent / 2
+				}
+			case "pow":
+				result, err = power(node.Children[0], node.Children[1])
+			default: // abs, min, max
+				err = same("compare")
+				result = operands[0]
+			}
+		case OperatorNode:
+			switch node.Value {
+			case "+":
+				err = same("add")
+				result = operands[0]
+			case "-":
+				err = same("subtract")
+				result = operands[0]
+			case "%":
+				err = same("take the remainder of")
+				result = operands[0]
+			case "*":
+				result = operands[0].add(operands[1], 1)
+			case "/", "//":
+				result = operands[0].add(operands[1], -1)
+			case "^":
+				result, err = power(node.Children[0], node.Children[1])
+			case "<", "<=", ">", ">=", "==", "!=":
+				err = same("compare")
+			case "&&", "||":
+			default: // побитовые операции
+				for _, d := range operands {
+					if d != (dimension{}) {
+						return dimension{}, fmt.Errorf("bitwise operation %v requires dimensionless operands, got %v", node.Value, d)
+					}
+				}
+			}
+		}
+		if err != nil {
+			return dimension{}, err
+		}
+		dims[node] = result
+		return result, nil
+	}
+
+	result, err := check(root)
+	if err != nil || result == (dimension{}) {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// convertUnit переводит значение value, записанное в единицах name, в основные единицы СИ
+func convertUnit(mode, value, name string) (string, error) {
+	number, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return "", fmt.Errorf("invalid number: %v", value)
+	}
+	u, _ := lookupUnit(name)
+	scale, _ := new(big.Rat).SetString(u.scale)
+	number.Mul(number, scale)
+
+	switch mode {
+	case tasks.BigIntMode:
+		if !number.IsInt() {
+			return "", fmt.Errorf("%v %v is not a whole number of %v in bigint mode", value, name, u.dim)
+		}
+		return number.Num().String(), nil
+	case tasks.RationalMode:
+		return number.RatString(), nil
+	}
+	converted, _ := number.Float64()
+	return FormatNumber(converted), nil
+}
@@ -0,0 +1,99 @@
+package evaluation
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUnitExponent(t *testing.T) {
+	tests := []struct {
+		expression string
+		postfix    []string
+	}{
+		{"5 m^2", []string{"5", "[m^2]"}},
+		{"5 m ^ 2", []string{"5", "[m^2]"}},
+		{"x s^-2", []string{"x", "[s^-2]"}},
+		{"(5 m)^2", []string{"5", "[m]", "2", "^"}},
+		{"5 m^2.5", []string{"5", "[m]", "2.5", "^"}},
+		{"5 m^x", []string{"5", "[m]", "x", "^"}},
+	}
+	for _, test := range tests {
+		postfix, err := InfixToPostfix(test.expression)
+		if err != nil {
+			t.Errorf("InfixToPostfix(%q): %v", test.expression, err)
+			continue
+		}
+		if !slices.Equal(postfix, test.postfix) {
+			t.Errorf("InfixToPostfix(%q) = %q, want %q", test.expression, postfix, test.postfix)
+		}
+	}
+}
+
+func TestCheckUnits(t *testing.T) {
+	tests := []struct {
+		expression string
+		unit       string
+		err        string
+	}{
+		{"5 km + 300 m", "m", ""},
+		{"5 m * 2 s", "m*s", ""},
+		{"5 m^2", "m^2", ""},
+		{"2 m ^ 2", "m^2", ""},
+		{"10 N * 2 m / 4 s", "W", ""},
+		{"1 m < 2 km", "", ""},
+		{"2 + 3", "", ""},
+		{"5 km + 3 s", "", "incompatible units: cannot add m and s"},
+		{"2 m ^ x", "", "a quantity in m can only be raised to an integer constant"},
+		{"1 m & 2", "", "bitwise operation & requires dimensionless operands, got m"},
+	}
+	for _, test := range tests {
+		unit, err := CheckUnits(parseTree(t, test.expression))
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("CheckUnits(%q): %v", test.expression, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("CheckUnits(%q): got error %v, want %q", test.expression, err, test.err)
+		case unit != test.unit:
+			t.Errorf("CheckUnits(%q) = %q, want %q", test.expression, unit, test.unit)
+		}
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	tests := []struct {
+		mode, value, unit string
+		result            string
+		err               string
+	}{
+		{"float", "5", "km", "5000", ""},
+		{"float", "1.5", "kPa", "1500", ""},
+		{"float", "2", "km^2", "2000000", ""},
+		{"rational", "1/2", "km", "500", ""},
+		{"rational", "1", "minute^-1", "1/60", ""},
+		{"bigint", "3", "h", "10800", ""},
+		{"bigint", "5", "mm", "", "5 mm is not a whole number of m in bigint mode"},
+	}
+	for _, test := range tests {
+		result, err := convertUnit(test.mode, test.value, test.unit)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("convertUnit(%v, %v %v): %v", test.mode, test.value, test.unit, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("convertUnit(%v, %v %v): got error %v, want %q", test.mode, test.value, test.unit, err, test.err)
+		case result != test.result:
+			t.Errorf("convertUnit(%v, %v %v) = %v, want %v", test.mode, test.value, test.unit, result, test.result)
+		}
+	}
+}
+
+func TestUnitsDoNotShadowNames(t *testing.T) {
+	// min — функция, t — обычная переменная
+	for _, name := range []string{"min", "max", "t"} {
+		if _, known := lookupUnit(name); known {
+			t.Errorf("%v is registered as a unit", name)
+		}
+	}
+	if _, err := InfixToPostfix("min(5 minute, t)"); err != nil {
+		t.Errorf("InfixToPostfix: %v", err)
+	}
+}
@@ -1,14 +1,28 @@
 package expression_structs
 
-import "sync"
+import (
+	"distributed_calculator/evaluation"
+	"sync"
+	"time"
+)
 
 type Expression struct {
-	ID         int
-	UserID     int
-	Expression string
-	Postfix    []string
-	Status     string
-	Result     int
+	ID          int
+	UserID      int
+	Expression  string
+	Mode        string            // режим вычислений: float, bigint или rational
+	Priority    int               // вес задач выражения в очереди: tasks.LowPriority, NormalPriority или HighPriority
+	Postfix     []string          // постфиксная запись выражения после подстановки переменных
+	Graph       *evaluation.Graph // граф вычисления выражения
+	Status      string
+	Result      string
+	Unit        string            // единица измерения результата в основных единицах СИ; пустая — безразмерный
+	FormulaID   int               // сохраненная формула, из которой создано выражение (0 — нет)
+	Bindings    map[string]string // значения переменных, с которыми посчитано выражение
+	Normalized  string            // каноническая запись выражения для поиска уже посчитанных
+	SourceID    int               // выражение, результат которого использован вместо вычисления (0 — нет)
+	EstimatedMs int               // оценка времени вычисления при создании выражения
+	Deadline    time.Time         // после этого момента вычисление отменяется; нулевое — без срока
 }
 
 type Expressions struct {
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResultCache — общий для всех выражений кэш результатов операций. Размер кэша ограничен:
+// при переполнении вытесняется давно не использованная запись. Записи устаревают через ttl.
+// Методы можно вызывать у nil — тогда кэш отключен
+type ResultCache struct {
+	mx       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List // записи от недавно использованных к давно не использованным
+	hits     int
+	misses   int
+}
+
+type cacheEntry struct {
+	key     string
+	result  string
+	expires time.Time
+}
+
+type CacheStats struct { // статистика кэша результатов
+	Hits     int   `json:"hits"`
+	Misses   int   `json:"misses"`
+	Size     int   `json:"size"`
+	Capacity int   `json:"capacity"`
+	TTLMs    int64 `json:"ttl_ms"`
+}
+
+// NewResultCache создает кэш на capacity записей; при capacity <= 0 кэш отключен (возвращается nil)
+func NewResultCache(capacity int, ttl time.Duration) *ResultCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &ResultCache{capacity: capacity, ttl: ttl, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// CacheKey возвращает ключ операции: режим, оператор или имя функции и аргументы
+func CacheKey(mode, operator string, args ...string) string {
+	return mode + "\x00" + operator + "\x00" + strings.Join(args, "\x00")
+}
+
+// Get возвращает сохраненный результат операции и учитывает попадание или промах
+func (c *ResultCache) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	element, exists := c.entries[key]
+	if exists && time.Now().After(element.Value.(*cacheEntry).expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		exists = false
+	}
+	if !exists {
+		c.misses++
+		return "", false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).result, true
+}
+
+// Put сохраняет результат операции
+func (c *ResultCache) Put(key, result string) {
+	if c == nil {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if element, exists := c.entries[key]; exists {
+		entry := element.Value.(*cacheEntry)
+		entry.result, entry.expires = result, expires
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result, expires: expires})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *ResultCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Size: c.order.Len(), Capacity: c.capacity, TTLMs: c.ttl.Milliseconds()}
+}
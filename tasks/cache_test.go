@@ -0,0 +1,71 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultCacheLRU(t *testing.T) {
+	cache := NewResultCache(2, time.Minute)
+	cache.Put("a", "1")
+	cache.Put("b", "2")
+	cache.Get("a") // b теперь давно не использовалась
+	cache.Put("c", "3")
+
+	tests := []struct {
+		key    string
+		result string
+		found  bool
+	}{
+		{"a", "1", true},
+		{"b", "", false},
+		{"c", "3", true},
+	}
+	for _, test := range tests {
+		result, found := cache.Get(test.key)
+		if result != test.result || found != test.found {
+			t.Errorf("Get(%q) = %q, %v, want %q, %v", test.key, result, found, test.result, test.found)
+		}
+	}
+	want := CacheStats{Hits: 3, Misses: 1, Size: 2, Capacity: 2, TTLMs: 60000}
+	if stats := cache.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestResultCacheTTL(t *testing.T) {
+	cache := NewResultCache(10, 30*time.Millisecond)
+	cache.Put("a", "1")
+	if _, found := cache.Get("a"); !found {
+		t.Fatal("fresh entry is not found")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, found := cache.Get("a"); found {
+		t.Error("expired entry is found")
+	}
+	if size := cache.Stats().Size; size != 0 {
+		t.Errorf("expired entry is kept, size %d", size)
+	}
+
+	cache.Put("b", "1")
+	time.Sleep(20 * time.Millisecond)
+	cache.Put("b", "2") // повторная запись продлевает срок
+	time.Sleep(20 * time.Millisecond)
+	if result, found := cache.Get("b"); !found || result != "2" {
+		t.Errorf("Get(b) = %q, %v, want 2, true", result, found)
+	}
+}
+
+func TestResultCacheDisabled(t *testing.T) {
+	cache := NewResultCache(0, time.Minute)
+	if cache != nil {
+		t.Fatal("cache with zero capacity is not disabled")
+	}
+	cache.Put("a", "1")
+	if _, found := cache.Get("a"); found {
+		t.Error("disabled cache returns a result")
+	}
+	if stats := cache.Stats(); stats != (CacheStats{}) {
+		t.Errorf("Stats() = %+v, want zero", stats)
+	}
+}
@@ -0,0 +1,269 @@
+package tasks
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"math/rand"
+)
+
+const ( // приоритеты выражений — вес среди задач одного пользователя: сколько задач подряд
+	// приоритет отдает за свой ход, прежде чем уступить другому приоритету того же пользователя
+	LowPriority    = 1
+	NormalPriority = 2
+	HighPriority   = 4
+)
+
+const turnTasks = 4 // сколько задач подряд пользователь получает за свой ход, какими бы ни были их приоритеты
+
+var priorities = map[string]int{
+	"low":    LowPriority,
+	"normal": NormalPriority,
+	"high":   HighPriority,
+}
+
+// ParsePriority возвращает вес приоритета low, normal или high; пустой приоритет — normal
+func ParsePriority(name string) (int, error) {
+	if name == "" {
+		return NormalPriority, nil
+	}
+	priority, exists := priorities[name]
+	if !exists {
+		return 0, fmt.Errorf("unknown priority: %v", name)
+	}
+	return priority, nil
+}
+
+const ( // политики выбора задачи среди задач одного приоритета
+	FIFOPolicy         = "fifo"          // в порядке поступления
+	RandomPolicy       = "random"        // случайная задача
+	CriticalPathPolicy = "critical-path" // задача с самым долгим оставшимся путем до результата выражения
+)
+
+type Owner struct { // выражение, которому принадлежит задача, и место задачи в очереди
+	ExpressionID int
+	UserID       int
+	Priority     int // вес среди задач пользователя: LowPriority, NormalPriority или HighPriority
+	Rank         int // самый долгий путь от задачи до результата выражения, мс (для CriticalPathPolicy)
+}
+
+// taskOrder — задачи одного потока, упорядоченные политикой очереди
+type taskOrder interface {
+	push(task *Task, front bool)
+	pop() *Task
+	remove(task *Task)
+	len() int
+}
+
+func newTaskOrder(policy string) taskOrder {
+	switch policy {
+	case RandomPolicy:
+		return &randomOrder{}
+	case CriticalPathPolicy:
+		return &criticalPathOrder{}
+	}
+	return &fifoOrder{tasks: list.New()}
+}
+
+type fifoOrder struct {
+	tasks *list.List // *Task
+}
+
+func (o *fifoOrder) push(task *Task, front bool) {
+	if front {
+		task.element = o.tasks.PushFront(task)
+	} else {
+		task.element = o.tasks.PushBack(task)
+	}
+}
+
+func (o *fifoOrder) pop() *Task {
+	return o.tasks.Remove(o.tasks.Front()).(*Task)
+}
+
+func (o *fifoOrder) remove(task *Task) {
+	o.tasks.Remove(task.element)
+}
+
+func (o *fifoOrder) len() int {
+	return o.tasks.Len()
+}
+
+type randomOrder struct {
+	tasks []*Task
+}
+
+func (o *randomOrder) push(task *Task, _ bool) {
+	task.index = len(o.tasks)
+	o.tasks = append(o.tasks, task)
+}
+
+func (o *randomOrder) pop() *Task {
+	task := o.tasks[rand.Intn(len(o.tasks))]
+	o.remove(task)
+	return task
+}
+
+// remove ставит на место задачи последнюю задачу потока
+func (o *randomOrder) remove(task *Task) {
+	last := o.tasks[len(o.tasks)-1]
+	o.tasks[task.index], last.index = last, task.index
+	o.tasks = o.tasks[:len(o.tasks)-1]
+}
+
+func (o *randomOrder) len() int {
+	return len(o.tasks)
+}
+
+// criticalPathOrder — куча задач по убыванию Rank, при равном Rank раньше старшая задача
+type criticalPathOrder struct {
+	tasks []*Task
+}
+
+func (o *criticalPathOrder) push(task *Task, _ bool) {
+	heap.Push(o, task)
+}
+
+func (o *criticalPathOrder) pop() *Task {
+	return heap.Pop(o).(*Task)
+}
+
+func (o *criticalPathOrder) remove(task *Task) {
+	heap.Remove(o, task.index)
+}
+
+func (o *criticalPathOrder) len() int {
+	return len(o.tasks)
+}
+
+// Len, Less, Swap, Push и Pop реализуют heap.Interface
+func (o *criticalPathOrder) Len() int {
+	return len(o.tasks)
+}
+
+func (o *criticalPathOrder) Less(i, j int) bool {
+	if o.tasks[i].Rank != o.tasks[j].Rank {
+		return o.tasks[i].Rank > o.tasks[j].Rank
+	}
+	return o.tasks[i].ID < o.tasks[j].ID
+}
+
+func (o *criticalPathOrder) Swap(i, j int) {
+	o.tasks[i], o.tasks[j] = o.tasks[j], o.tasks[i]
+	o.tasks[i].index, o.tasks[j].index = i, j
+}
+
+func (o *criticalPathOrder) Push(x any) {
+	task := x.(*Task)
+	task.index = len(o.tasks)
+	o.tasks = append(o.tasks, task)
+}
+
+func (o *criticalPathOrder) Pop() any {
+	task := o.tasks[len(o.tasks)-1]
+	o.tasks = o.tasks[:len(o.tasks)-1]
+	return task
+}
+
+type lane struct { // задачи одного пользователя с одним приоритетом
+	priority int
+	tasks    taskOrder
+	credits  int           // сколько задач приоритет еще отдаст в текущий ход
+	turn     *list.Element // место приоритета в кругу пользователя
+}
+
+type flow struct { // задачи одного пользователя
+	userID  int
+	lanes   map[int]*lane // по приоритету
+	turns   *list.List    // *lane, непустые приоритеты; первый — приоритет, чей сейчас ход
+	credits int           // сколько задач пользователь еще получит в текущий ход
+	turn    *list.Element // место пользователя в кругу очереди
+}
+
+// queue — очередь задач, ожидающих агента. Задачи разбиты на потоки по пользователю,
+// и потоки обслуживаются по кругу: за один ход поток отдает до turnTasks задач подряд
+// и уходит в конец круга. Поэтому пользователь с тысячами задач не задерживает остальных
+// дольше, чем на один ход, какой бы приоритет он ни указал. Внутри потока приоритеты
+// пользователя тоже чередуются по кругу (weighted round-robin): за свой ход приоритет
+// отдает столько задач подряд, каков его вес. Какую задачу отдает приоритет, определяет
+// политика: при FIFOPolicy и RandomPolicy все операции выполняются за O(1),
+// при CriticalPathPolicy — за O(log n) от числа задач приоритета.
+// Методы вызываются под Tasks.Mx
+type queue struct {
+	policy string
+	flows  map[int]*flow // по пользователю
+	turns  *list.List    // *flow, непустые потоки; первый — поток, чей сейчас ход
+}
+
+func newQueue() *queue {
+	return &queue{policy: CriticalPathPolicy, flows: make(map[int]*flow), turns: list.New()}
+}
+
+// push ставит задачу в ее поток; front — задача, которую не выполнил агент, и в FIFOPolicy
+// она встает в начало своего приоритета, так как старше остальных его задач
+func (q *queue) push(task *Task, front bool) {
+	f, exists := q.flows[task.UserID]
+	if !exists {
+		f = &flow{userID: task.UserID, lanes: make(map[int]*lane), turns: list.New(), credits: turnTasks}
+		f.turn = q.turns.PushBack(f)
+		q.flows[task.UserID] = f
+	}
+	l, exists := f.lanes[task.Priority]
+	if !exists {
+		l = &lane{priority: task.Priority, tasks: newTaskOrder(q.policy), credits: task.Priority}
+		l.turn = f.turns.PushBack(l)
+		f.lanes[task.Priority] = l
+	}
+	l.tasks.push(task, front)
+	task.queued = true
+}
+
+// pop забирает следующую задачу или возвращает nil, если очередь пуста
+func (q *queue) pop() *Task {
+	turn := q.turns.Front()
+	if turn == nil {
+		return nil
+	}
+	f := turn.Value.(*flow)
+	l := f.turns.Front().Value.(*lane)
+	task := l.tasks.pop()
+	task.queued = false
+
+	l.credits--
+	if l.tasks.len() == 0 {
+		q.drop(f, l)
+	} else if l.credits <= 0 { // ход приоритета закончен
+		l.credits = l.priority
+		f.turns.MoveToBack(l.turn)
+	}
+	f.credits--
+	if f.credits <= 0 && q.flows[f.userID] == f { // ход пользователя закончен
+		f.credits = turnTasks
+		q.turns.MoveToBack(turn)
+	}
+	return task
+}
+
+// remove убирает задачу из очереди, если она там есть
+func (q *queue) remove(task *Task) {
+	if !task.queued {
+		return
+	}
+	f := q.flows[task.UserID]
+	l := f.lanes[task.Priority]
+	l.tasks.remove(task)
+	task.queued = false
+	if l.tasks.len() == 0 {
+		q.drop(f, l)
+	}
+}
+
+// drop убирает опустевший приоритет из потока, а опустевший поток — из очереди
+func (q *queue) drop(f *flow, l *lane) {
+	f.turns.Remove(l.turn)
+	delete(f.lanes, l.priority)
+	if f.turns.Len() == 0 {
+		q.turns.Remove(f.turn)
+		delete(q.flows, f.userID)
+	}
+}
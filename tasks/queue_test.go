@@ -0,0 +1,134 @@
+package tasks
+
+import (
+	"slices"
+	"testing"
+)
+
+// pushTasks ставит в очередь count задач пользователя с приоритетом, начиная с id
+func pushTasks(q *queue, id, count, userID, priority int) {
+	for i := 0; i < count; i++ {
+		q.push(newTask(id+i, 0, Owner{UserID: userID, Priority: priority}, FloatMode, "+", "1", "1"), false)
+	}
+}
+
+// popAll забирает все задачи очереди и возвращает значения field для них
+func popAll(q *queue, field func(task *Task) int) []int {
+	var values []int
+	for task := q.pop(); task != nil; task = q.pop() {
+		values = append(values, field(task))
+	}
+	return values
+}
+
+func userOf(task *Task) int     { return task.UserID }
+func priorityOf(task *Task) int { return task.Priority }
+func idOf(task *Task) int       { return task.ID }
+
+func TestQueueFairness(t *testing.T) {
+	tests := []struct {
+		name  string
+		fill  func(q *queue)
+		field func(task *Task) int
+		want  []int
+	}{
+		{
+			name: "users take turns",
+			fill: func(q *queue) {
+				pushTasks(q, 1, 6, 1, NormalPriority)
+				pushTasks(q, 7, 6, 2, NormalPriority)
+			},
+			field: userOf,
+			want:  []int{1, 1, 1, 1, 2, 2, 2, 2, 1, 1, 2, 2},
+		},
+		{
+			// высокий приоритет не дает пользователю лишних ходов
+			name: "priority does not add turns",
+			fill: func(q *queue) {
+				pushTasks(q, 1, 8, 1, HighPriority)
+				pushTasks(q, 9, 8, 1, NormalPriority)
+				pushTasks(q, 17, 2, 2, LowPriority)
+			},
+			field: userOf,
+			want:  []int{1, 1, 1, 1, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		},
+		{
+			name: "priorities of one user are weighted",
+			fill: func(q *queue) {
+				pushTasks(q, 1, 8, 1, HighPriority)
+				pushTasks(q, 9, 4, 1, NormalPriority)
+				pushTasks(q, 13, 2, 1, LowPriority)
+			},
+			field: priorityOf,
+			want:  []int{4, 4, 4, 4, 2, 2, 1, 4, 4, 4, 4, 2, 2, 1},
+		},
+	}
+	for _, test := range tests {
+		q := newQueue()
+		q.policy = FIFOPolicy
+		test.fill(q)
+		if got := popAll(q, test.field); !slices.Equal(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		if len(q.flows) != 0 || q.turns.Len() != 0 {
+			t.Errorf("%v: queue is not empty after all tasks are taken", test.name)
+		}
+	}
+}
+
+func TestQueuePolicies(t *testing.T) {
+	ranked := func(id, rank int) *Task {
+		return newTask(id, 0, Owner{UserID: 1, Priority: NormalPriority, Rank: rank}, FloatMode, "+", "1", "1")
+	}
+	tests := []struct {
+		policy string
+		want   []int
+	}{
+		{FIFOPolicy, []int{4, 1, 2, 3}},         // задача 4 возвращена в начало
+		{CriticalPathPolicy, []int{2, 4, 1, 3}}, // по убыванию Rank, при равном Rank — по id
+	}
+	for _, test := range tests {
+		q := newQueue()
+		q.policy = test.policy
+		q.push(ranked(1, 100), false)
+		q.push(ranked(2, 300), false)
+		q.push(ranked(3, 100), false)
+		q.push(ranked(4, 200), true)
+		if got := popAll(q, idOf); !slices.Equal(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.policy, got, test.want)
+		}
+	}
+
+	q := newQueue()
+	q.policy = RandomPolicy
+	pushTasks(q, 1, 10, 1, NormalPriority)
+	got := popAll(q, idOf)
+	slices.Sort(got)
+	if !slices.Equal(got, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}) {
+		t.Errorf("%v: got %v, want every task once", RandomPolicy, got)
+	}
+}
+
+func TestQueueRemove(t *testing.T) {
+	for _, policy := range []string{FIFOPolicy, RandomPolicy, CriticalPathPolicy} {
+		q := newQueue()
+		q.policy = policy
+		var tasks []*Task
+		for id := 1; id <= 4; id++ {
+			task := newTask(id, 0, Owner{UserID: id % 2, Priority: NormalPriority}, FloatMode, "+", "1", "1")
+			tasks = append(tasks, task)
+			q.push(task, false)
+		}
+		q.remove(tasks[1])
+		q.remove(tasks[3]) // у пользователя 0 больше нет задач
+		q.remove(tasks[3]) // повторное удаление ничего не делает
+		if _, exists := q.flows[0]; exists {
+			t.Errorf("%v: flow of a user without tasks is kept", policy)
+		}
+		got := popAll(q, idOf)
+		slices.Sort(got)
+		if !slices.Equal(got, []int{1, 3}) {
+			t.Errorf("%v: got %v, want [1 3]", policy, got)
+		}
+	}
+}
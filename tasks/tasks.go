@@ -1,115 +1,274 @@
 package tasks
 
 import (
+	"container/list"
 	"context"
-	"distributed_calculator/expression_structs"
+	"errors"
 	"fmt"
-	"strconv"
 	"sync"
 	"time"
 )
 
+const ( // режимы вычислений выражения
+	FloatMode    = "float"    // числа с плавающей точкой (float64)
+	BigIntMode   = "bigint"   // целые числа произвольной длины (math/big.Int)
+	RationalMode = "rational" // точные дроби (math/big.Rat)
+)
+
+func ValidMode(mode string) bool {
+	switch mode {
+	case FloatMode, BigIntMode, RationalMode:
+		return true
+	}
+	return false
+}
+
 type Task struct { // структура задачи
 	ID               int       `json:"id"`
 	ExpressionID     int       `json:"expression"` // выражение, к которому относится задача
+	Mode             string    `json:"mode"`       // режим вычислений, в котором записаны аргументы
 	Operator         string    `json:"operation"`  // оператор арифметической операции
-	Arg1             int       `json:"arg1"`
-	Arg2             int       `json:"arg2"`
+	Arg1             string    `json:"arg1"`       // аргументы передаются строками, чтобы не терять точность
+	Arg2             string    `json:"arg2"`
+	Args             []string  `json:"args,omitempty"`    // аргументы вызова функции, если Operator — имя функции
 	OperationTime    int       `json:"operation_time"`    // время на выполнение операции
-	TimeoutTimestamp time.Time `json:"timeout_timestamp"` // время, когда задача должна быть выполнена агентом,
-	// который её принял
-	ContextCancel context.CancelFunc `json:"-"` // функция отмены контекста задачи
+	TimeoutTimestamp time.Time `json:"timeout_timestamp"` // когда истекает аренда задачи агентом, который её принял;
+	// агент продлевает аренду через Heartbeat
+	LeaseMs       int                `json:"lease_ms"`        // на сколько продлевается аренда при каждом Heartbeat
+	ContextCancel context.CancelFunc `json:"-"`               // функция отмены контекста задачи
+	Agent         string             `json:"agent,omitempty"` // агент, который взял задачу
+	CreatedAt     time.Time          `json:"-"`               // когда задача поставлена в очередь
+	LeasedAt      time.Time          `json:"-"`               // когда агент взял задачу; нулевое — задача ждет в очереди
+	Attempts      int                `json:"attempt"`         // сколько раз задача выдавалась агентам
+	UserID        int                `json:"-"`               // пользователь, чье выражение вычисляется
+	Priority      int                `json:"-"`               // вес среди задач пользователя в очереди
+	Rank          int                `json:"-"`               // самый долгий путь от задачи до результата выражения, мс
+
+	queued  bool          // задача ждет агента в очереди
+	element *list.Element // место задачи в потоке при FIFOPolicy
+	index   int           // место задачи в потоке при RandomPolicy и CriticalPathPolicy
 }
 
 type Tasks struct { // структура списка задач
-	Tasks  map[int]*Task // мапа с очередью задач
-	Mx     sync.Mutex
-	lastID int
+	Tasks     map[int]*Task // все задачи: ожидающие агента, выданные агентам и ждущие повторной выдачи
+	Mx        sync.Mutex
+	OnTimeout func(task *Task) // вызывается без блокировки Mx, когда аренда задачи истекла
+	Cache     *ResultCache     // результаты уже выполненных операций; nil — кэш отключен
+	Lease     time.Duration    // длительность аренды задачи агентом
+
+	MaxAttempts  int           // сколько раз выдавать задачу, прежде чем вызвать OnTimeout
+	RetryBackoff time.Duration // пауза перед второй попыткой; перед каждой следующей она удваивается
+	lastID       int
+	queue        *queue // задачи, ожидающие агента
 }
 
-func newTask(id, operTime, expressionID int, operator string, arg1, arg2 int) *Task {
+func newTask(id, operTime int, owner Owner, mode, operator, arg1, arg2 string) *Task {
 	return &Task{ID: id,
-		OperationTime:    operTime,
-		ExpressionID:     expressionID,
-		Operator:         operator,
-		Arg1:             arg1,
-		Arg2:             arg2,
-		TimeoutTimestamp: time.Now().Add(time.Millisecond * time.Duration(operTime) * 2),
+		OperationTime: operTime,
+		ExpressionID:  owner.ExpressionID,
+		UserID:        owner.UserID,
+		Priority:      owner.Priority,
+		Rank:          owner.Rank,
+		Mode:          mode,
+		Operator:      operator,
+		Arg1:          arg1,
+		Arg2:          arg2,
+		CreatedAt:     time.Now(),
 	}
 }
 
 func NewTasks() *Tasks {
-	return &Tasks{Mx: sync.Mutex{}, lastID: 0, Tasks: make(map[int]*Task)}
+	return &Tasks{Mx: sync.Mutex{}, lastID: 0, Tasks: make(map[int]*Task), queue: newQueue()}
 }
 
-func (t *Tasks) AddTask(time, expressionID int, operator string, arg1, arg2 int) string {
+func (t *Tasks) AddTask(time int, owner Owner, mode, operator, arg1, arg2 string) int {
 	t.Mx.Lock()
 	defer t.Mx.Unlock()
 	new_id := t.lastID + 1
-	new_task := newTask(new_id, time, expressionID, operator, arg1, arg2)
+	new_task := newTask(new_id, time, owner, mode, operator, arg1, arg2)
 	t.Tasks[t.lastID+1] = new_task
+	t.queue.push(new_task, false)
 	t.lastID++
 
-	return strconv.Itoa(new_id)
+	return new_id
 }
 
-func (t *Tasks) GetTask(expressionsList *expression_structs.Expressions) (*Task, error) {
+func (t *Tasks) AddFunctionTask(time int, owner Owner, mode, function string, args []string) int {
 	t.Mx.Lock()
 	defer t.Mx.Unlock()
+	new_id := t.lastID + 1
+	new_task := newTask(new_id, time, owner, mode, function, "", "")
+	new_task.Args = args
+	t.Tasks[new_id] = new_task
+	t.queue.push(new_task, false)
+	t.lastID++
 
-	for _, task := range t.Tasks {
-		if task.ContextCancel == nil {
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Millisecond*time.Duration(task.OperationTime))
-			task.ContextCancel = cancel
-			task.TimeoutTimestamp = time.Now().Add(2 * time.Millisecond * time.Duration(task.OperationTime))
-			go t.monitorTask(ctx, task.ID, expressionsList)
-			return task, nil
-		}
+	return new_id
+}
+
+var (
+	ErrTaskNotFound  = errors.New("task not found")
+	ErrNotLeaseOwner = errors.New("task is leased by another agent")
+)
+
+// SetPolicy задает политику выбора задачи среди задач одного приоритета: FIFOPolicy, RandomPolicy
+// или CriticalPathPolicy (по умолчанию). Вызывается до добавления задач
+func (t *Tasks) SetPolicy(policy string) error {
+	switch policy {
+	case FIFOPolicy, RandomPolicy, CriticalPathPolicy:
+	default:
+		return fmt.Errorf("unknown scheduling policy: %v", policy)
 	}
-	return nil, fmt.Errorf("no task found")
+	t.Mx.Lock()
+	defer t.Mx.Unlock()
+	t.queue.policy = policy
+	return nil
 }
 
-func (t *Tasks) monitorTask(ctx context.Context, taskID int, expressionList *expression_structs.Expressions) {
-	<-ctx.Done()
+// GetTask выдает агенту agent следующую задачу очереди в аренду на Lease. Очередь
+// распределяет задачи между пользователями с учетом приоритета (queue)
+func (t *Tasks) GetTask(agent string) (*Task, error) {
 	t.Mx.Lock()
 	defer t.Mx.Unlock()
-	if task, exists := t.Tasks[taskID]; exists {
-		if time.Now().After(task.TimeoutTimestamp) {
-			fmt.Printf("Task #%d timed out and was removed\n", taskID)
+
+	task := t.queue.pop()
+	if task == nil {
+		return nil, fmt.Errorf("no task found")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	task.ContextCancel = cancel
+	task.Agent = agent
+	task.LeasedAt = time.Now()
+	task.Attempts++
+	task.TimeoutTimestamp = task.LeasedAt.Add(t.Lease)
+	task.LeaseMs = int(t.Lease / time.Millisecond)
+	go t.monitorTask(ctx, task.ID)
+	return task, nil
+}
+
+// Heartbeat продлевает аренду задачи агентом agent на Lease и возвращает новый срок аренды.
+// Если аренда уже истекла и задача удалена, возвращает ErrTaskNotFound
+func (t *Tasks) Heartbeat(id int, agent string) (time.Time, error) {
+	t.Mx.Lock()
+	defer t.Mx.Unlock()
+
+	task, exists := t.Tasks[id]
+	if !exists || task.ContextCancel == nil {
+		return time.Time{}, ErrTaskNotFound
+	}
+	if task.Agent != agent {
+		return time.Time{}, ErrNotLeaseOwner
+	}
+	task.TimeoutTimestamp = time.Now().Add(t.Lease)
+	return task.TimeoutTimestamp, nil
+}
+
+// monitorTask ждет окончания аренды задачи; если агент продлил аренду, ждет дальше.
+// Если аренда истекла, задача возвращается в очередь (retry), а после MaxAttempts
+// попыток удаляется, и вызывается OnTimeout. Отмена ctx означает, что задача выполнена,
+// удалена или уже возвращена в очередь
+func (t *Tasks) monitorTask(ctx context.Context, taskID int) {
+	for {
+		t.Mx.Lock()
+		task, exists := t.Tasks[taskID]
+		if !exists || ctx.Err() != nil {
+			t.Mx.Unlock()
+			return
+		}
+		wait := time.Until(task.TimeoutTimestamp)
+		expired := wait <= 0
+		failed := expired && task.Attempts >= t.MaxAttempts
+		if failed {
+			fmt.Printf("Lease of task #%d expired after %d attempts, task was removed\n", taskID, task.Attempts)
 			delete(t.Tasks, taskID)
+		} else if expired {
+			t.retry(task)
+		}
+		t.Mx.Unlock()
 
-			expressionList.Mx.Lock()
-			for _, expr := range expressionList.Expressions {
-				if expr.ID == task.ExpressionID {
-					expr.Status = "Error: timeout"
-				}
-			}
-			expressionList.Mx.Unlock()
-
-			for _, tsk := range t.Tasks {
-				if tsk.ExpressionID == task.ExpressionID {
-					_, err := t.CompleteTask(tsk.ID)
-					if err != nil {
-						fmt.Printf("Error: %v\n", err)
-					}
-				}
+		if failed && t.OnTimeout != nil {
+			t.OnTimeout(task)
+		}
+		if expired {
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// retry возвращает задачу, аренда которой истекла, в начало ее потока в очереди после паузы
+// RetryBackoff, удваивающейся с каждой попыткой. Вызывается под Mx
+func (t *Tasks) retry(task *Task) {
+	delay := t.RetryBackoff << min(task.Attempts-1, 16)
+	fmt.Printf("Lease of task #%d expired (attempt %d of %d), retrying in %v\n", task.ID, task.Attempts, t.MaxAttempts, delay)
+	task.ContextCancel()
+	task.ContextCancel = nil
+	task.Agent = ""
+	task.LeasedAt = time.Time{}
+	time.AfterFunc(delay, func() {
+		t.Mx.Lock()
+		defer t.Mx.Unlock()
+		// за время паузы задачу могли выполнить (поздний результат) или удалить вместе с выражением
+		if current, exists := t.Tasks[task.ID]; exists && current.ContextCancel == nil && !current.queued {
+			t.queue.push(current, true)
+		}
+	})
+}
+
+// Lookup возвращает копию задачи, которая еще находится в очереди
+func (t *Tasks) Lookup(id int) (Task, bool) {
+	t.Mx.Lock()
+	defer t.Mx.Unlock()
+
+	task, exists := t.Tasks[id]
+	if !exists {
+		return Task{}, false
+	}
+	return *task, true
+}
+
+// RemoveExpressionTasks удаляет из очереди все задачи выражения
+func (t *Tasks) RemoveExpressionTasks(expressionID int) {
+	t.Mx.Lock()
+	defer t.Mx.Unlock()
+
+	for id, task := range t.Tasks {
+		if task.ExpressionID == expressionID {
+			if task.ContextCancel != nil {
+				task.ContextCancel()
 			}
+			t.queue.remove(task)
+			delete(t.Tasks, id)
 		}
 	}
 }
 
-func (t *Tasks) CompleteTask(id int) (*Task, error) {
+// CompleteTask удаляет выполненную задачу из очереди. Если agent не пустой, результат
+// не принимается, когда аренду задачи держит другой агент; результат агента, аренда
+// которого истекла, принимается, пока задачу не взял никто другой
+func (t *Tasks) CompleteTask(id int, agent string) (*Task, error) {
 	t.Mx.Lock()
 	defer t.Mx.Unlock()
 
 	task, exists := t.Tasks[id]
 	if !exists {
-		return nil, fmt.Errorf("task not found")
+		return nil, ErrTaskNotFound
+	}
+	if agent != "" && task.Agent != "" && task.Agent != agent {
+		return nil, ErrNotLeaseOwner
 	}
 
 	if task.ContextCancel != nil {
 		task.ContextCancel()
 	}
+	t.queue.remove(task)
 	delete(t.Tasks, id)
 
 	return task, nil
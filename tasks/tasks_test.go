@@ -0,0 +1,97 @@
+package tasks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitFor ждет, пока выполнится условие, не дольше timeout
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return condition()
+}
+
+func TestLeaseExpiryAndRetry(t *testing.T) {
+	taskList := NewTasks()
+	taskList.Lease = 20 * time.Millisecond
+	taskList.MaxAttempts = 2
+	taskList.RetryBackoff = 200 * time.Millisecond
+	timedOut := make(chan int, 1)
+	taskList.OnTimeout = func(task *Task) { timedOut <- task.ID }
+
+	id := taskList.AddTask(0, Owner{UserID: 1, Priority: NormalPriority}, FloatMode, "+", "1", "2")
+	if _, err := taskList.GetTask("a"); err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	expired := time.Now().Add(taskList.Lease)
+
+	// аренда истекла, но задача вернется в очередь только после паузы
+	time.Sleep(100 * time.Millisecond)
+	if _, err := taskList.GetTask("b"); err == nil {
+		t.Fatal("task is given out again before the retry backoff")
+	}
+	var task *Task
+	if !waitFor(time.Second, func() bool {
+		task, _ = taskList.GetTask("b")
+		return task != nil
+	}) {
+		t.Fatal("task is not retried after the lease expired")
+	}
+	if elapsed := time.Since(expired); elapsed < taskList.RetryBackoff {
+		t.Errorf("task is retried %v after the lease expired, want at least %v", elapsed, taskList.RetryBackoff)
+	}
+	if task.ID != id || task.Agent != "b" {
+		t.Errorf("got task %d of agent %q, want task %d of agent b", task.ID, task.Agent, id)
+	}
+
+	// вторая аренда тоже истекает: попыток больше нет
+	select {
+	case timedOutID := <-timedOut:
+		if timedOutID != id {
+			t.Errorf("OnTimeout got task %d, want %d", timedOutID, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnTimeout is not called after the last attempt")
+	}
+	if _, exists := taskList.Lookup(id); exists {
+		t.Error("task is kept after the last attempt")
+	}
+}
+
+func TestHeartbeatAndComplete(t *testing.T) {
+	taskList := NewTasks()
+	taskList.Lease = 50 * time.Millisecond
+	taskList.MaxAttempts = 1
+	taskList.OnTimeout = func(task *Task) { t.Errorf("lease of task %d expired despite heartbeats", task.ID) }
+
+	id := taskList.AddTask(0, Owner{UserID: 1, Priority: NormalPriority}, FloatMode, "+", "1", "2")
+	if _, err := taskList.GetTask("a"); err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		time.Sleep(25 * time.Millisecond)
+		if _, err := taskList.Heartbeat(id, "a"); err != nil {
+			t.Fatalf("Heartbeat: %v", err)
+		}
+	}
+	if _, err := taskList.Heartbeat(id, "b"); !errors.Is(err, ErrNotLeaseOwner) {
+		t.Errorf("Heartbeat of another agent: got %v, want %v", err, ErrNotLeaseOwner)
+	}
+	if _, err := taskList.CompleteTask(id, "b"); !errors.Is(err, ErrNotLeaseOwner) {
+		t.Errorf("CompleteTask of another agent: got %v, want %v", err, ErrNotLeaseOwner)
+	}
+	if _, err := taskList.CompleteTask(id, "a"); err != nil {
+		t.Errorf("CompleteTask: %v", err)
+	}
+	if _, err := taskList.Heartbeat(id, "a"); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Heartbeat of a completed task: got %v, want %v", err, ErrTaskNotFound)
+	}
+	time.Sleep(2 * taskList.Lease) // OnTimeout не должен вызываться для выполненной задачи
+}